@@ -14,6 +14,7 @@ require (
 	github.com/urfave/cli/v3 v3.0.0-beta1
 	github.com/zclconf/go-cty v1.14.4
 	golang.design/x/clipboard v0.7.0
+	golang.org/x/sys v0.28.0
 )
 
 require (
@@ -42,7 +43,6 @@ require (
 	golang.org/x/mobile v0.0.0-20230301163155-e0f57694e12c // indirect
 	golang.org/x/mod v0.21.0 // indirect
 	golang.org/x/sync v0.10.0 // indirect
-	golang.org/x/sys v0.28.0 // indirect
 	golang.org/x/text v0.14.0 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
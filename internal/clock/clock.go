@@ -0,0 +1,20 @@
+// Package clock abstracts the source of the current time, so that the durations can be computed
+// against either the wall clock (for a live run), or the recorded timestamps (for a replay).
+package clock
+
+import "time"
+
+type Clock interface {
+	Now() time.Time
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+// Real returns the wall clock.
+func Real() Clock {
+	return realClock{}
+}
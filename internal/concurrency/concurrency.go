@@ -0,0 +1,233 @@
+// Package concurrency analyzes how many resource operations are in flight at each moment, against the parallelism
+// limit of Terraform (i.e. the -parallelism option).
+package concurrency
+
+import (
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/magodo/pipeform/internal/state"
+)
+
+// DefaultParallelism is the default of the -parallelism option of Terraform.
+const DefaultParallelism = 10
+
+// saturationThreshold is the ratio of the saturated time to the span, beyond which the operations are regarded as
+// limited by the parallelism.
+const saturationThreshold = 0.2
+
+// blockedThreshold is the ratio of a blocked stretch to the span, beyond which the stretch is reported.
+const blockedThreshold = 0.1
+
+// Stretch is a period when a single operation is in flight, which blocks everything else.
+type Stretch struct {
+	Info  *state.ResourceOperationInfo
+	Start time.Time
+	End   time.Time
+}
+
+func (s Stretch) Duration() time.Duration {
+	return s.End.Sub(s.Start)
+}
+
+type Analysis struct {
+	Parallelism int
+	// Count is the count of the analyzed operations
+	Count int
+
+	// Start is the start time of the first operation
+	Start time.Time
+	// Span is the period from the start of the first operation to the end of the last one
+	Span time.Duration
+
+	// Peak is the maximum count of the operations in flight at a moment
+	Peak int
+	// Average is the time weighted average count of the operations in flight during the span
+	Average float64
+	// Saturated is the time when the count of the operations in flight reaches the parallelism
+	Saturated time.Duration
+
+	// Blocked are the stretches longer than 10% of the span, when a single operation is in flight
+	Blocked []Stretch
+}
+
+type point struct {
+	t     time.Time
+	start bool
+	info  *state.ResourceOperationInfo
+}
+
+// Analyze analyzes the concurrency of the operations, the in-progress ones are regarded to end at now.
+func Analyze(infos []*state.ResourceOperationInfo, parallelism int, now time.Time) Analysis {
+	a := Analysis{Parallelism: parallelism}
+
+	var points []point
+	for _, info := range infos {
+		if info.StartTime.IsZero() {
+			continue
+		}
+		end := info.EndTime
+		if end.IsZero() {
+			end = now
+		}
+		points = append(points, point{t: info.StartTime, start: true, info: info}, point{t: end, info: info})
+		a.Count++
+	}
+	if len(points) == 0 {
+		return a
+	}
+
+	// The operations that end at the same time as others start aren't regarded as overlapping.
+	slices.SortStableFunc(points, func(a, b point) int {
+		if c := a.t.Compare(b.t); c != 0 {
+			return c
+		}
+		switch {
+		case a.start == b.start:
+			return 0
+		case a.start:
+			return 1
+		default:
+			return -1
+		}
+	})
+
+	var (
+		weighted time.Duration
+		prev     time.Time
+		inFlight = map[*state.ResourceOperationInfo]bool{}
+		stretch  *Stretch
+		blocked  []Stretch
+	)
+	for i := 0; i < len(points); {
+		t := points[i].t
+		if i > 0 {
+			dt := t.Sub(prev)
+			weighted += dt * time.Duration(len(inFlight))
+			if len(inFlight) >= parallelism {
+				a.Saturated += dt
+			}
+			if len(inFlight) == 1 && dt > 0 {
+				var info *state.ResourceOperationInfo
+				for info = range inFlight {
+				}
+				if stretch != nil && stretch.Info == info && stretch.End.Equal(prev) {
+					stretch.End = t
+				} else {
+					blocked = append(blocked, Stretch{Info: info, Start: prev, End: t})
+					stretch = &blocked[len(blocked)-1]
+				}
+			} else if dt > 0 {
+				stretch = nil
+			}
+		}
+		for ; i < len(points) && points[i].t.Equal(t); i++ {
+			if points[i].start {
+				inFlight[points[i].info] = true
+			} else {
+				delete(inFlight, points[i].info)
+			}
+		}
+		a.Peak = max(a.Peak, len(inFlight))
+		prev = t
+	}
+
+	a.Start = points[0].t
+	a.Span = prev.Sub(a.Start)
+	if a.Span > 0 {
+		a.Average = float64(weighted) / float64(a.Span)
+	}
+	for _, s := range blocked {
+		if s.Duration() > time.Duration(float64(a.Span)*blockedThreshold) {
+			a.Blocked = append(a.Blocked, s)
+		}
+	}
+	return a
+}
+
+// ParallelismLimited tells whether the operations are limited by the parallelism, i.e. they were saturated for
+// a considerable time, so raising the parallelism might speed them up.
+func (a Analysis) ParallelismLimited() bool {
+	return a.Span > 0 && float64(a.Saturated)/float64(a.Span) > saturationThreshold
+}
+
+// Lines renders the analysis as lines of text, which are empty if there is no operation.
+func (a Analysis) Lines() []string {
+	if a.Count == 0 {
+		return nil
+	}
+
+	var ratio float64
+	if a.Span > 0 {
+		ratio = float64(a.Saturated) / float64(a.Span) * 100
+	}
+	lines := []string{
+		fmt.Sprintf("Concurrency of %d operations in %s:", a.Count, a.Span),
+		fmt.Sprintf("  peak: %d/%d, average: %.1f", a.Peak, a.Parallelism, a.Average),
+		fmt.Sprintf("  saturated at the parallelism: %s (%.0f%%)", a.Saturated, ratio),
+	}
+	if len(a.Blocked) != 0 {
+		lines = append(lines, "  blocked by a single operation:")
+		for _, s := range a.Blocked {
+			lines = append(lines, fmt.Sprintf("    %s (%s): %s, from +%s to +%s", s.Info.Loc.ResourceAddr, s.Info.Loc.Action, s.Duration(), s.Start.Sub(a.Start), s.End.Sub(a.Start)))
+		}
+	}
+	if a.ParallelismLimited() {
+		lines = append(lines, "  The operations are limited by the parallelism, raising it might speed them up.")
+	} else {
+		lines = append(lines, "  The operations are not limited by the parallelism, raising it is unlikely to speed them up.")
+	}
+	return lines
+}
+
+// CriticalPath returns the longest chain of sequential operations, i.e. each operation starts after the previous
+// one ends, which is the likely critical path of the run. The length of a chain is the sum of the durations of its
+// operations, where the in-progress ones are regarded to end at now.
+func CriticalPath(infos []*state.ResourceOperationInfo, now time.Time) []*state.ResourceOperationInfo {
+	type op struct {
+		info       *state.ResourceOperationInfo
+		start, end time.Time
+	}
+	var ops []op
+	for _, info := range infos {
+		if info.StartTime.IsZero() {
+			continue
+		}
+		end := info.EndTime
+		if end.IsZero() {
+			end = now
+		}
+		ops = append(ops, op{info: info, start: info.StartTime, end: end})
+	}
+	slices.SortStableFunc(ops, func(a, b op) int {
+		return a.end.Compare(b.end)
+	})
+
+	// length[i] is the length of the longest chain ending with ops[i], whose previous operation is ops[prev[i]].
+	length := make([]time.Duration, len(ops))
+	prev := make([]int, len(ops))
+	last := -1
+	for i, o := range ops {
+		prev[i] = -1
+		for j := 0; j < i && !ops[j].end.After(o.start); j++ {
+			if prev[i] == -1 || length[j] > length[prev[i]] {
+				prev[i] = j
+			}
+		}
+		length[i] = o.end.Sub(o.start)
+		if prev[i] != -1 {
+			length[i] += length[prev[i]]
+		}
+		if last == -1 || length[i] > length[last] {
+			last = i
+		}
+	}
+
+	var path []*state.ResourceOperationInfo
+	for i := last; i != -1; i = prev[i] {
+		path = append(path, ops[i].info)
+	}
+	slices.Reverse(path)
+	return path
+}
@@ -0,0 +1,84 @@
+package concurrency_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/magodo/pipeform/internal/concurrency"
+	"github.com/magodo/pipeform/internal/state"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAnalyze(t *testing.T) {
+	base := time.Date(2025, 1, 10, 10, 0, 0, 0, time.UTC)
+	newInfo := func(addr string, start, end int) *state.ResourceOperationInfo {
+		info := &state.ResourceOperationInfo{
+			Loc:       state.ResourceOperationInfoLocator{ResourceAddr: addr, Action: "create"},
+			Status:    state.ResourceOperationStatusComplete,
+			StartTime: base.Add(time.Duration(start) * time.Second),
+		}
+		if end >= 0 {
+			info.EndTime = base.Add(time.Duration(end) * time.Second)
+		} else {
+			info.Status = state.ResourceOperationStatusStart
+		}
+		return info
+	}
+
+	// Two operations run in parallel for 10s, then a third one starts right after they end, and runs alone
+	// until now, i.e. for 30s.
+	long := newInfo("null_resource.long", 10, -1)
+	infos := []*state.ResourceOperationInfo{
+		newInfo("null_resource.a", 0, 10),
+		newInfo("null_resource.b", 0, 10),
+		long,
+		// Not started yet
+		{Status: state.ResourceOperationStatusPending},
+	}
+
+	a := concurrency.Analyze(infos, 2, base.Add(40*time.Second))
+	require.Equal(t, 3, a.Count)
+	require.Equal(t, base, a.Start)
+	require.Equal(t, 40*time.Second, a.Span)
+	require.Equal(t, 2, a.Peak)
+	require.Equal(t, 1.25, a.Average)
+	require.Equal(t, 10*time.Second, a.Saturated)
+	require.Equal(t, []concurrency.Stretch{{Info: long, Start: base.Add(10 * time.Second), End: base.Add(40 * time.Second)}}, a.Blocked)
+	require.True(t, a.ParallelismLimited())
+
+	// With the default parallelism, it is never saturated
+	a = concurrency.Analyze(infos, concurrency.DefaultParallelism, base.Add(40*time.Second))
+	require.Zero(t, a.Saturated)
+	require.False(t, a.ParallelismLimited())
+	require.Equal(t, []string{
+		"Concurrency of 3 operations in 40s:",
+		"  peak: 2/10, average: 1.2",
+		"  saturated at the parallelism: 0s (0%)",
+		"  blocked by a single operation:",
+		"    null_resource.long (create): 30s, from +10s to +40s",
+		"  The operations are not limited by the parallelism, raising it is unlikely to speed them up.",
+	}, a.Lines())
+
+	require.Empty(t, concurrency.Analyze(nil, 10, base).Lines())
+}
+
+func TestCriticalPath(t *testing.T) {
+	base := time.Date(2025, 1, 10, 10, 0, 0, 0, time.UTC)
+	newInfo := func(addr string, start, end int) *state.ResourceOperationInfo {
+		return &state.ResourceOperationInfo{
+			Loc:       state.ResourceOperationInfoLocator{ResourceAddr: addr, Action: "create"},
+			StartTime: base.Add(time.Duration(start) * time.Second),
+			EndTime:   base.Add(time.Duration(end) * time.Second),
+		}
+	}
+
+	// a (0-5) -> c (5-20) is longer than b (0-12) -> d (12-15), and e (1-18) alone
+	a := newInfo("a", 0, 5)
+	b := newInfo("b", 0, 12)
+	c := newInfo("c", 5, 20)
+	d := newInfo("d", 12, 15)
+	e := newInfo("e", 1, 18)
+	require.Equal(t, []*state.ResourceOperationInfo{a, c}, concurrency.CriticalPath([]*state.ResourceOperationInfo{a, b, c, d, e}, base))
+
+	require.Empty(t, concurrency.CriticalPath(nil, base))
+}
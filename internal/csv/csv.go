@@ -1,19 +1,18 @@
 package csv
 
 import (
-	"strings"
+	"bytes"
+	gocsv "encoding/csv"
+	"time"
 
-	"github.com/magodo/pipeform/internal/state"
+	"github.com/magodo/pipeform/internal/engine"
 )
 
-type Input struct {
-	RefreshInfos state.ResourceOperationInfos
-	ApplyInfos   state.ResourceOperationInfos
-}
-
-func ToCsv(input Input) []byte {
-	out := []string{
-		strings.Join([]string{
+// ToCsv renders the timing of each operation recorded by the engine. The now is used to calculate the
+// duration of the in-progress operations. The fields are quoted where needed, e.g. a module key with a comma.
+func ToCsv(e *engine.Engine, now time.Time) []byte {
+	out := [][]string{
+		{
 			"Start Timestamp",
 			"End Timestamp",
 			"Stage",
@@ -24,9 +23,15 @@ func ToCsv(input Input) []byte {
 			"Resource Key",
 			"Status",
 			"Duration (sec)",
-		}, ","),
+		},
 	}
-	out = append(out, input.RefreshInfos.ToCsv("refresh")...)
-	out = append(out, input.ApplyInfos.ToCsv("apply")...)
-	return []byte(strings.Join(out, "\n"))
+	out = append(out, e.RefreshInfos().ToCsv(string(engine.StageRefresh), now)...)
+	out = append(out, e.ApplyInfos().ToCsv(string(engine.StageApply), now)...)
+	out = append(out, e.AuxInfos().ToCsv(string(engine.StageAux), now)...)
+	out = append(out, e.TestInfos().ToCsv(now)...)
+
+	var buf bytes.Buffer
+	// Writing to the buffer never fails
+	gocsv.NewWriter(&buf).WriteAll(out)
+	return buf.Bytes()
 }
@@ -0,0 +1,215 @@
+// Package diag renders the Terraform diagnostics for humans, in the way similar to Terraform's own output.
+package diag
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/magodo/pipeform/terraform/views/json"
+	"github.com/muesli/reflow/ansi"
+	"github.com/muesli/reflow/wordwrap"
+)
+
+var (
+	colorRed     = lipgloss.AdaptiveColor{Dark: "#ED567A", Light: "#FF4672"}
+	colorFuschia = lipgloss.AdaptiveColor{Dark: "#EE6FF8", Light: "#EE6FF8"}
+	colorGrey    = lipgloss.AdaptiveColor{Light: "#B2B2B2", Dark: "#4A4A4A"}
+)
+
+type styles struct {
+	err       lipgloss.Style
+	warning   lipgloss.Style
+	bold      lipgloss.Style
+	highlight lipgloss.Style
+	comment   lipgloss.Style
+}
+
+var (
+	colorStyles = styles{
+		err:       lipgloss.NewStyle().Foreground(colorRed).Bold(true),
+		warning:   lipgloss.NewStyle().Foreground(colorFuschia).Bold(true),
+		bold:      lipgloss.NewStyle().Bold(true),
+		highlight: lipgloss.NewStyle().Underline(true).Bold(true),
+		comment:   lipgloss.NewStyle().Foreground(colorGrey),
+	}
+	plainStyles = styles{
+		err:       lipgloss.NewStyle(),
+		warning:   lipgloss.NewStyle(),
+		bold:      lipgloss.NewStyle(),
+		highlight: lipgloss.NewStyle(),
+		comment:   lipgloss.NewStyle(),
+	}
+)
+
+type options struct {
+	width int
+	color bool
+}
+
+type Option func(*options)
+
+// WithWidth wraps the detail to fit in the width, including the leading bar.
+func WithWidth(width int) Option {
+	return func(o *options) {
+		o.width = width
+	}
+}
+
+// WithColor renders the severity with colors, and the highlighted range of the snippet with an underline.
+// Otherwise, the highlighted range is marked by a line of carets below the code.
+func WithColor(enabled bool) Option {
+	return func(o *options) {
+		o.color = enabled
+	}
+}
+
+func newOptions(opts []Option) options {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+func (o options) styles() styles {
+	if o.color {
+		return colorStyles
+	}
+	return plainStyles
+}
+
+// RenderAll renders the diagnostics, separated by blank lines.
+func RenderAll(diags []json.Diagnostic, opts ...Option) string {
+	var blocks []string
+	for _, diag := range diags {
+		blocks = append(blocks, Render(diag, opts...))
+	}
+	return strings.Join(blocks, "\n\n")
+}
+
+// Summary renders the diagnostic in one line, e.g. "Error: Invalid function argument".
+func Summary(diag json.Diagnostic, opts ...Option) string {
+	o := newOptions(opts)
+	style, title := severity(diag, o.styles())
+	return style.Render(title+": ") + diag.Summary
+}
+
+// Render renders the diagnostic as a block: the severity and the summary, the address, the source range
+// together with the snippet and the expression values, then the detail.
+func Render(diag json.Diagnostic, opts ...Option) string {
+	o := newOptions(opts)
+	st := o.styles()
+	style, title := severity(diag, st)
+
+	lines := []string{style.Render(title+": ") + st.bold.Render(diag.Summary)}
+
+	if diag.Address != "" || diag.Range != nil {
+		lines = append(lines, "")
+	}
+	if diag.Address != "" {
+		with := "  with " + diag.Address
+		if diag.Range != nil {
+			with += ","
+		}
+		lines = append(lines, with)
+	}
+	if diag.Range != nil {
+		on := fmt.Sprintf("  on %s line %d", diag.Range.Filename, diag.Range.Start.Line)
+		if snippet := diag.Snippet; snippet != nil && snippet.Context != nil {
+			on += fmt.Sprintf(", in %s", *snippet.Context)
+		}
+		lines = append(lines, on+":")
+		if diag.Snippet != nil {
+			lines = append(lines, snippetLines(*diag.Snippet, o.color, st)...)
+		}
+	}
+
+	if diag.Detail != "" {
+		detail := diag.Detail
+		// Leave room for the bar
+		if o.width > 2 {
+			detail = wordwrap.String(detail, o.width-2)
+		}
+		lines = append(lines, "")
+		lines = append(lines, strings.Split(detail, "\n")...)
+	}
+
+	bar := style.Render("│")
+	for i, line := range lines {
+		if line == "" {
+			lines[i] = bar
+			continue
+		}
+		lines[i] = bar + " " + line
+	}
+	return style.Render("╷") + "\n" + strings.Join(lines, "\n") + "\n" + style.Render("╵")
+}
+
+func severity(diag json.Diagnostic, st styles) (lipgloss.Style, string) {
+	switch diag.Severity {
+	case json.DiagnosticSeverityError:
+		return st.err, "Error"
+	case json.DiagnosticSeverityWarning:
+		return st.warning, "Warning"
+	default:
+		return st.warning, diag.Severity
+	}
+}
+
+// snippetLines renders the source code with the line numbers, where the highlighted range is emphasized.
+// The function call and the expression values (if any) are listed below the code.
+func snippetLines(snippet json.DiagnosticSnippet, color bool, st styles) []string {
+	var lines []string
+
+	start, end := snippet.HighlightStartOffset, snippet.HighlightEndOffset
+	offset := 0
+	for i, code := range strings.Split(snippet.Code, "\n") {
+		lineStart, lineEnd := offset, offset+len(code)
+		offset = lineEnd + 1
+
+		// Clamp the highlighted range to this line
+		hs, he := max(start, lineStart)-lineStart, min(end, lineEnd)-lineStart
+		if hs >= he {
+			lines = append(lines, fmt.Sprintf("%4d: %s", snippet.StartLine+i, code))
+			continue
+		}
+		if color {
+			lines = append(lines, fmt.Sprintf("%4d: %s", snippet.StartLine+i, code[:hs]+st.highlight.Render(code[hs:he])+code[he:]))
+			continue
+		}
+		lines = append(lines,
+			fmt.Sprintf("%4d: %s", snippet.StartLine+i, code),
+			strings.Repeat(" ", 6+ansi.PrintableRuneWidth(code[:hs]))+strings.Repeat("^", ansi.PrintableRuneWidth(code[hs:he])),
+		)
+	}
+
+	var values []string
+	if call := snippet.FunctionCall; call != nil {
+		values = append(values, "while calling "+functionCallString(*call))
+	}
+	for _, value := range snippet.Values {
+		values = append(values, value.Traversal+" "+value.Statement)
+	}
+	if len(values) != 0 {
+		lines = append(lines, "    "+st.comment.Render("├────────────────"))
+		for _, value := range values {
+			lines = append(lines, "    "+st.comment.Render("│")+" "+value)
+		}
+	}
+	return lines
+}
+
+func functionCallString(call json.DiagnosticFunctionCall) string {
+	if call.Signature == nil {
+		return call.CalledAs + "(...)"
+	}
+	var params []string
+	for _, param := range call.Signature.Params {
+		params = append(params, param.Name)
+	}
+	if param := call.Signature.VariadicParam; param != nil {
+		params = append(params, param.Name+"...")
+	}
+	return fmt.Sprintf("%s(%s)", call.CalledAs, strings.Join(params, ", "))
+}
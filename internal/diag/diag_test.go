@@ -0,0 +1,89 @@
+package diag_test
+
+import (
+	"testing"
+
+	"github.com/magodo/pipeform/internal/diag"
+	"github.com/magodo/pipeform/terraform/views/json"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRender(t *testing.T) {
+	context := `resource "null_resource" "bad"`
+	d := json.Diagnostic{
+		Severity: json.DiagnosticSeverityError,
+		Summary:  "Invalid function argument",
+		Detail:   "Invalid value for \"number\" parameter: number required.",
+		Address:  "null_resource.bad",
+		Range: &json.DiagnosticRange{
+			Filename: "main.tf",
+			Start:    json.Pos{Line: 3, Column: 13, Byte: 55},
+			End:      json.Pos{Line: 3, Column: 18, Byte: 60},
+		},
+		Snippet: &json.DiagnosticSnippet{
+			Context:              &context,
+			Code:                 "  triggers = {\n    n = abs(var.x)\n  }",
+			StartLine:            2,
+			HighlightStartOffset: 27,
+			HighlightEndOffset:   32,
+			Values: []json.DiagnosticExpressionValue{
+				{Traversal: "var.x", Statement: `is "foo"`},
+			},
+			FunctionCall: &json.DiagnosticFunctionCall{
+				CalledAs: "abs",
+				Signature: &json.Function{
+					Name:   "abs",
+					Params: []json.FunctionParam{{Name: "num"}},
+				},
+			},
+		},
+	}
+
+	require.Equal(t, `╷
+│ Error: Invalid function argument
+│
+│   with null_resource.bad,
+│   on main.tf line 3, in resource "null_resource" "bad":
+│    2:   triggers = {
+│    3:     n = abs(var.x)
+│                   ^^^^^
+│    4:   }
+│     ├────────────────
+│     │ while calling abs(num)
+│     │ var.x is "foo"
+│
+│ Invalid value for "number" parameter: number required.
+╵`, diag.Render(d))
+}
+
+func TestRenderAll(t *testing.T) {
+	diags := []json.Diagnostic{
+		{
+			Severity: json.DiagnosticSeverityWarning,
+			Summary:  "Deprecated attribute",
+			Detail:   "The attribute foo is deprecated, use bar instead.",
+		},
+		{
+			Severity: json.DiagnosticSeverityError,
+			Summary:  "Unsupported argument",
+		},
+	}
+	require.Equal(t, `╷
+│ Warning: Deprecated attribute
+│
+│ The attribute foo is
+│ deprecated, use bar
+│ instead.
+╵
+
+╷
+│ Error: Unsupported argument
+╵`, diag.RenderAll(diags, diag.WithWidth(22)))
+}
+
+func TestSummary(t *testing.T) {
+	require.Equal(t, "Error: Unsupported argument", diag.Summary(json.Diagnostic{
+		Severity: json.DiagnosticSeverityError,
+		Summary:  "Unsupported argument",
+	}))
+}
@@ -0,0 +1,30 @@
+package engine
+
+import (
+	"strings"
+
+	"github.com/magodo/pipeform/terraform/views/json"
+)
+
+type Diags []json.Diagnostic
+
+func (diags Diags) HasError() bool {
+	for _, diag := range diags {
+		if strings.EqualFold(diag.Severity, "error") {
+			return true
+		}
+	}
+	return false
+}
+
+// Count returns the count of the warning and the error diagnostics.
+func (diags Diags) Count() (warnings, errors int) {
+	for _, diag := range diags {
+		if strings.EqualFold(diag.Severity, "error") {
+			errors++
+		} else {
+			warnings++
+		}
+	}
+	return warnings, errors
+}
@@ -0,0 +1,561 @@
+// Package engine consumes the Terraform messages and maintains the canonical state of the run,
+// on top of which the UIs and the exporters are rendered.
+package engine
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/magodo/pipeform/internal/history"
+	"github.com/magodo/pipeform/internal/log"
+	"github.com/magodo/pipeform/internal/state"
+	"github.com/magodo/pipeform/terraform/views"
+	"github.com/magodo/pipeform/terraform/views/json"
+)
+
+type Engine struct {
+	logger *log.Logger
+
+	startTime time.Time
+
+	phase         Phase
+	visitedPhases []Phase
+	// phaseStartTimes are the start times of the visited phases
+	phaseStartTimes []time.Time
+
+	version string
+	// versionWarned tells whether the unsupported UI protocol version has been warned
+	versionWarned bool
+
+	// These are read from the ChangeSummaryMsg
+	operation     json.Operation
+	totalCnt      int
+	changeSummary *json.ChangeSummary
+
+	doneCnt int
+
+	// auxDoneCnt counts the done operations of the aux stage, which are excluded from the progress
+	auxDoneCnt int
+
+	diags Diags
+
+	// rawLines are the lines in the stream that aren't Terraform messages
+	rawLines []string
+
+	refreshInfos state.ResourceOperationInfos
+	driftInfos   state.DriftInfos
+	planInfos    state.PlanInfos
+	applyInfos   state.ResourceOperationInfos
+	auxInfos     state.ResourceOperationInfos
+	outputInfos  state.OutputInfos
+	testInfos    state.TestInfos
+
+	// history is used to expect the durations of the refresh and the apply operations, if set.
+	history *history.History
+}
+
+type Option func(*Engine)
+
+// WithHistory sets the history, from which the durations of the refresh and the apply operations are expected.
+func WithHistory(h *history.History) Option {
+	return func(e *Engine) {
+		e.history = h
+	}
+}
+
+// New creates the engine. If startTime is zero, the timestamp of the first message is used instead.
+func New(logger *log.Logger, startTime time.Time, opts ...Option) *Engine {
+	e := &Engine{
+		logger:          logger,
+		startTime:       startTime,
+		phase:           PhaseIdle,
+		visitedPhases:   []Phase{PhaseIdle},
+		phaseStartTimes: []time.Time{startTime},
+	}
+	for _, opt := range opts {
+		opt(e)
+	}
+	return e
+}
+
+func (e *Engine) StartTime() time.Time {
+	return e.startTime
+}
+
+func (e *Engine) Phase() Phase {
+	return e.phase
+}
+
+// VisitedPhases returns the phases that the run has entered, in order.
+func (e *Engine) VisitedPhases() []Phase {
+	return e.visitedPhases
+}
+
+// PhaseStartTimes returns the start times of the visited phases, in the same order as VisitedPhases.
+// A phase ends when the next one starts.
+func (e *Engine) PhaseStartTimes() []time.Time {
+	return e.phaseStartTimes
+}
+
+// Version returns the message of the version message, e.g. "Terraform 1.10.3".
+func (e *Engine) Version() string {
+	return e.version
+}
+
+func (e *Engine) Operation() json.Operation {
+	return e.operation
+}
+
+// ChangeSummary returns the latest change summary, e.g. the one after apply, or nil if there is none.
+func (e *Engine) ChangeSummary() *json.ChangeSummary {
+	return e.changeSummary
+}
+
+// TotalCount returns the count of the resource operations to apply.
+func (e *Engine) TotalCount() int {
+	return e.totalCnt
+}
+
+// DoneCount returns the count of the applied (either complete or errored) resource operations.
+// The operations of the aux stage are excluded.
+func (e *Engine) DoneCount() int {
+	return e.doneCnt
+}
+
+// AuxDoneCount returns the count of the done (either complete or errored) operations of the aux stage.
+func (e *Engine) AuxDoneCount() int {
+	return e.auxDoneCnt
+}
+
+// Diags returns the warning and error diagnostics.
+func (e *Engine) Diags() Diags {
+	return e.diags
+}
+
+func (e *Engine) RawLines() []string {
+	return e.rawLines
+}
+
+func (e *Engine) RefreshInfos() state.ResourceOperationInfos {
+	return e.refreshInfos
+}
+
+func (e *Engine) DriftInfos() state.DriftInfos {
+	return e.driftInfos
+}
+
+func (e *Engine) PlanInfos() state.PlanInfos {
+	return e.planInfos
+}
+
+func (e *Engine) ApplyInfos() state.ResourceOperationInfos {
+	return e.applyInfos
+}
+
+// AuxInfos returns the operations of the aux stage, i.e. the data source reads and the ephemeral resource operations.
+func (e *Engine) AuxInfos() state.ResourceOperationInfos {
+	return e.auxInfos
+}
+
+func (e *Engine) OutputInfos() state.OutputInfos {
+	return e.outputInfos
+}
+
+func (e *Engine) TestInfos() state.TestInfos {
+	return e.testInfos
+}
+
+// Apply applies the message to the state, and returns the events of the changes in order.
+func (e *Engine) Apply(msg views.Message) []Event {
+	var events []Event
+
+	if ts := msg.BaseMessage().TimeStamp; e.startTime.IsZero() && !ts.IsZero() {
+		e.startTime = ts
+		e.phaseStartTimes[0] = ts
+	}
+
+	switch msg := msg.(type) {
+	case views.VersionMsg:
+		e.version = msg.Message
+		if !views.IsUIVersionSupported(msg.UI) && !e.versionWarned {
+			e.versionWarned = true
+			diag := json.Diagnostic{
+				Severity: json.DiagnosticSeverityWarning,
+				Summary:  "Unsupported UI protocol version",
+				Detail:   fmt.Sprintf("The UI protocol version %s is newer than %s, which pipeform is built for. Some messages might not be recognized.", msg.UI, views.SupportedUIVersion),
+			}
+			e.diags = append(e.diags, diag)
+			events = append(events, UnsupportedVersionEvent{UI: msg.UI, Diag: diag})
+		}
+
+	case views.LogMsg:
+		// There's no much useful information for now.
+
+	case views.DiagnosticsMsg:
+		switch strings.ToLower(msg.Level) {
+		case "warn", "error":
+			e.diags = append(e.diags, *msg.Diagnostic)
+			info := e.linkDiagnostic(*msg.Diagnostic)
+			events = append(events, DiagnosticEvent{Diag: *msg.Diagnostic, Info: info})
+		}
+
+	case views.ResourceDriftMsg:
+		info := &state.DriftInfo{
+			Resource: msg.Change.Resource,
+			Action:   msg.Change.Action,
+		}
+		e.driftInfos = append(e.driftInfos, info)
+		events = append(events, DriftEvent{Info: info})
+
+	case views.PlannedChangeMsg:
+		info := &state.PlanInfo{
+			Resource:     msg.Change.Resource,
+			Action:       msg.Change.Action,
+			PrevResource: msg.Change.PreviousResource,
+			Reason:       msg.Change.Reason,
+		}
+		e.planInfos = append(e.planInfos, info)
+		events = append(events, PlannedChangeEvent{Info: info})
+
+		for _, action := range plannedOperations(*msg.Change) {
+			info := &state.ResourceOperationInfo{
+				RawResourceAddr: msg.Change.Resource,
+				Loc:             locator(msg.Change.Resource, string(action)),
+				Status:          state.ResourceOperationStatusPending,
+			}
+			info.Expected = e.history.Expected(string(StageApply), info)
+			e.applyInfos.AddPending(info)
+		}
+
+		// Normally, we don't need to handle the PlannedChangeMsg here, as the ChangeSummaryMsg has all these information.
+		// The exception is that when apply with a plan file, there is no ChangeSummaryMsg sent from Terraform at this moment.
+		// (see: https://github.com/magodo/pipeform/issues/1)
+		// The counting here is a fallback logic to cover the case above. Otherwise, it will just be overwritten by ChangeSummaryMsg.
+		//
+		// TODO: Once https://github.com/hashicorp/terraform/pull/36245 merged, remove this part.
+		//
+		// Referencing the logic of terraform: internal/command/views/operation.go
+		// But we also count the "import"
+		switch msg.Change.Action {
+		case json.ActionCreate:
+			e.totalCnt++
+		case json.ActionDelete:
+			e.totalCnt++
+		case json.ActionUpdate:
+			e.totalCnt++
+		case json.ActionReplace:
+			e.totalCnt += 2
+		case json.ActionImport:
+			e.totalCnt++
+		}
+
+	case views.ChangeSummaryMsg:
+		changes := msg.Changes
+		e.logger.Debug("Change summary", "add", changes.Add, "change", changes.Change, "import", changes.Import, "remove", changes.Remove)
+		e.totalCnt = changes.Add + changes.Change + changes.Import + changes.Remove
+		e.operation = changes.Operation
+		e.changeSummary = changes
+		if e.phase != PhaseTest {
+			events = append(events, ProgressEvent{Total: e.totalCnt, Done: e.doneCnt})
+		}
+
+	case views.OutputMsg:
+		var names []string
+		for name := range msg.Outputs {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			o := msg.Outputs[name]
+			if o.Action != "" {
+				continue
+			}
+			e.outputInfos = append(e.outputInfos, &state.OutputInfo{
+				Name:      name,
+				Sensitive: o.Sensitive,
+				Type:      o.Type,
+				ValueStr:  o.Value,
+				Action:    o.Action,
+			})
+		}
+		events = append(events, OutputsEvent{Infos: e.outputInfos})
+
+	case views.HookMsg:
+		e.logger.Debug("Hook message", "type", fmt.Sprintf("%T", msg.Hook))
+		events = append(events, e.applyHook(msg)...)
+
+	case views.TestAbstractMsg:
+		e.testInfos = state.NewTestInfos(msg.TestAbstract)
+
+	case views.TestFileMsg:
+		info := e.testInfos.Upsert(msg.TestFile.Path, "", msg.TestFile.Progress, msg.TestFile.Status, nil, msg.TimeStamp)
+		events = append(events, TestEvent{Info: info})
+
+	case views.TestRunMsg:
+		info := e.testInfos.Upsert(msg.TestRun.Path, msg.TestRun.Run, msg.TestRun.Progress, msg.TestRun.Status, msg.TestRun.Elapsed, msg.TimeStamp)
+		events = append(events, TestEvent{Info: info})
+		if total, done := e.testInfos.RunCount(); total != 0 {
+			events = append(events, ProgressEvent{Total: total, Done: done})
+		}
+
+	case views.TestSummaryMsg:
+		e.logger.Debug("Test summary", "status", msg.TestSummary.Status, "passed", msg.TestSummary.Passed, "failed", msg.TestSummary.Failed, "errored", msg.TestSummary.Errored, "skipped", msg.TestSummary.Skipped)
+
+	case views.TestPlanMsg, views.TestStateMsg, views.TestCleanupMsg, views.TestInterruptMsg, views.TestStatusMsg, views.TestRetryMsg:
+		// There's no much useful information for now.
+
+	case views.RawLineMsg:
+		e.rawLines = append(e.rawLines, msg.Message)
+		events = append(events, RawLineEvent{Line: msg.Message})
+
+	case views.UnknownMsg:
+		// Its message is still shown by the UIs.
+		e.logger.Warn("Unknown message type", "type", msg.Type)
+
+	default:
+		e.logger.Error("Unhandled message", "type", fmt.Sprintf("%T", msg))
+	}
+
+	if phase, change := e.phase.NextPhase(msg); change {
+		e.logger.Info("Phase change", "old", e.phase.String(), "new", phase.String())
+		events = append(events, PhaseChangedEvent{From: e.phase, To: phase})
+		e.phase = phase
+		e.visitedPhases = append(e.visitedPhases, phase)
+		e.phaseStartTimes = append(e.phaseStartTimes, msg.BaseMessage().TimeStamp)
+	}
+
+	return events
+}
+
+func (e *Engine) applyHook(msg views.HookMsg) []Event {
+	switch hook := msg.Hook.(type) {
+	case json.RefreshStart:
+		info := &state.ResourceOperationInfo{
+			Idx:             e.refreshInfos.Len() + 1,
+			RawResourceAddr: hook.Resource,
+			Loc:             locator(hook.Resource, "refresh"),
+			Status:          state.ResourceOperationStatusStart,
+			StartTime:       msg.TimeStamp,
+			IDKey:           hook.IDKey,
+			IDValue:         hook.IDValue,
+		}
+		info.Expected = e.history.Expected(string(StageRefresh), info)
+		e.refreshInfos.Add(info)
+		return []Event{OperationEvent{Stage: StageRefresh, Info: info}}
+
+	case json.RefreshComplete:
+		status := state.ResourceOperationStatusComplete
+		info := e.refreshInfos.Update(locator(hook.Resource, "refresh"), state.ResourceOperationInfoUpdate{
+			Status:  &status,
+			Endtime: &msg.TimeStamp,
+		})
+		if info == nil {
+			e.logger.Error("RefreshComplete hook can't find the resource info", "module", hook.Resource.Module, "addr", hook.Resource.Addr, "action", "refresh")
+			return nil
+		}
+		setID(info, hook.IDKey, hook.IDValue)
+		return []Event{OperationEvent{Stage: StageRefresh, Info: info}}
+
+	case json.OperationStart:
+		infos, stage := e.operationInfos(hook.Action)
+		info := &state.ResourceOperationInfo{
+			Idx:             infos.Len() + 1,
+			RawResourceAddr: hook.Resource,
+			Loc:             locator(hook.Resource, string(hook.Action)),
+			Status:          state.ResourceOperationStatusStart,
+			StartTime:       msg.TimeStamp,
+			IDKey:           hook.IDKey,
+			IDValue:         hook.IDValue,
+		}
+		if stage != StageAux {
+			info.Expected = e.history.Expected(string(stage), info)
+		}
+		infos.Add(info)
+		return []Event{OperationEvent{Stage: stage, Info: info}}
+
+	case json.OperationProgress:
+		infos, stage := e.operationInfos(hook.Action)
+		info := infos.Find(locator(hook.Resource, string(hook.Action)))
+		if info == nil {
+			e.logger.Error("OperationProgress hook can't find the resource info", "module", hook.Resource.Module, "addr", hook.Resource.Addr, "action", hook.Action)
+			return nil
+		}
+		return []Event{OperationEvent{Stage: stage, Info: info}}
+
+	case json.OperationComplete:
+		// The id of a created resource is only known once the operation completes.
+		infos, _ := e.operationInfos(hook.Action)
+		if info := infos.Find(locator(hook.Resource, string(hook.Action))); info != nil {
+			setID(info, hook.IDKey, hook.IDValue)
+		}
+		return e.endOperation(msg, "OperationComplete", hook.Resource, hook.Action, state.ResourceOperationStatusComplete)
+
+	case json.OperationErrored:
+		return e.endOperation(msg, "OperationErrored", hook.Resource, hook.Action, state.ResourceOperationStatusErrored)
+
+	case json.ProvisionStart:
+		info := e.findProvisioned(hook.Resource, "ProvisionStart")
+		if info == nil {
+			return nil
+		}
+		p := &state.ProvisionerInfo{
+			Provisioner: hook.Provisioner,
+			Status:      state.ResourceOperationStatusStart,
+			StartTime:   msg.TimeStamp,
+		}
+		info.Provisioners = append(info.Provisioners, p)
+		info.Status = state.ResourceOperationStatusProvisioning
+		return []Event{ProvisionerEvent{Info: info, Provisioner: p}}
+
+	case json.ProvisionProgress:
+		info := e.findProvisioned(hook.Resource, "ProvisionProgress")
+		if info == nil {
+			return nil
+		}
+		p := info.RunningProvisioner()
+		if p == nil {
+			e.logger.Error("ProvisionProgress hook can't find the running provisioner", "module", hook.Resource.Module, "addr", hook.Resource.Addr, "provisioner", hook.Provisioner)
+			return nil
+		}
+		p.Output = append(p.Output, hook.Output)
+		return []Event{ProvisionerEvent{Info: info, Provisioner: p}}
+
+	case json.ProvisionComplete:
+		return e.endProvisioner(msg, "ProvisionComplete", hook.Resource, hook.Provisioner, state.ResourceOperationStatusComplete)
+
+	case json.ProvisionErrored:
+		return e.endProvisioner(msg, "ProvisionErrored", hook.Resource, hook.Provisioner, state.ResourceOperationStatusErrored)
+
+	default:
+	}
+	return nil
+}
+
+// findProvisioned finds the apply info of the resource that runs the provisioner.
+// The provisioner hooks don't tell the action, so the latest operation of the resource is used.
+func (e *Engine) findProvisioned(addr json.ResourceAddr, hookName string) *state.ResourceOperationInfo {
+	info := e.applyInfos.FindLatest(addr.Addr)
+	if info == nil {
+		e.logger.Error(hookName+" hook can't find the resource info", "module", addr.Module, "addr", addr.Addr)
+	}
+	return info
+}
+
+func (e *Engine) endProvisioner(msg views.HookMsg, hookName string, addr json.ResourceAddr, provisioner string, status state.ResourceOperationStatus) []Event {
+	info := e.findProvisioned(addr, hookName)
+	if info == nil {
+		return nil
+	}
+	p := info.RunningProvisioner()
+	if p == nil {
+		e.logger.Error(hookName+" hook can't find the running provisioner", "module", addr.Module, "addr", addr.Addr, "provisioner", provisioner)
+		return nil
+	}
+	p.Status = status
+	p.EndTime = msg.TimeStamp
+
+	// The operation itself is still in progress, until the OperationComplete or OperationErrored hook.
+	if info.Status == state.ResourceOperationStatusProvisioning {
+		info.Status = state.ResourceOperationStatusStart
+	}
+	return []Event{ProvisionerEvent{Info: info, Provisioner: p}}
+}
+
+// linkDiagnostic links the diagnostic to the latest operation of the resource at its address, preferring the apply
+// operations to the aux ones, then the refresh ones. It returns the linked info, if any.
+func (e *Engine) linkDiagnostic(diag json.Diagnostic) *state.ResourceOperationInfo {
+	if diag.Address == "" {
+		return nil
+	}
+	info := e.applyInfos.FindLatest(diag.Address)
+	if info == nil {
+		info = e.auxInfos.FindLatest(diag.Address)
+	}
+	if info == nil {
+		info = e.refreshInfos.FindLatest(diag.Address)
+	}
+	if info == nil {
+		return nil
+	}
+	info.Diags = append(info.Diags, diag)
+	return info
+}
+
+func (e *Engine) endOperation(msg views.HookMsg, hookName string, addr json.ResourceAddr, action json.ChangeAction, status state.ResourceOperationStatus) []Event {
+	infos, stage := e.operationInfos(action)
+	info := infos.Update(locator(addr, string(action)), state.ResourceOperationInfoUpdate{
+		Status:  &status,
+		Endtime: &msg.TimeStamp,
+	})
+	if info == nil {
+		e.logger.Error(hookName+" hook can't find the resource info", "module", addr.Module, "addr", addr.Addr, "action", action)
+		return nil
+	}
+
+	events := []Event{OperationEvent{Stage: stage, Info: info}}
+	if stage == StageAux {
+		// Not counted in the change summary, so excluded from the progress
+		e.auxDoneCnt += 1
+		return events
+	}
+
+	e.doneCnt += 1
+	if e.phase != PhaseTest {
+		events = append(events, ProgressEvent{Total: e.totalCnt, Done: e.doneCnt})
+	}
+	return events
+}
+
+// operationInfos returns the infos (and the stage) that the operation of the action belongs to.
+func (e *Engine) operationInfos(action json.ChangeAction) (*state.ResourceOperationInfos, Stage) {
+	if IsAuxAction(action) {
+		return &e.auxInfos, StageAux
+	}
+	return &e.applyInfos, StageApply
+}
+
+// IsAuxAction tells whether the operation of the action belongs to the aux stage, i.e. a data source read or
+// an ephemeral resource operation. These operations aren't counted in the change summary.
+func IsAuxAction(action json.ChangeAction) bool {
+	switch action {
+	case json.ActionRead, json.ActionOpen, json.ActionRenew, json.ActionClose:
+		return true
+	}
+	return false
+}
+
+// plannedOperations returns the actions of the operations that the planned change will be applied with,
+// in the order of the OperationStart hooks.
+func plannedOperations(change json.ResourceInstanceChange) []json.ChangeAction {
+	var actions []json.ChangeAction
+	// An import is applied as a separate operation before the change (if any), even if the action isn't "import".
+	if change.Importing != nil || change.Action == json.ActionImport {
+		actions = append(actions, json.ActionImport)
+	}
+	switch change.Action {
+	case json.ActionCreate, json.ActionUpdate, json.ActionDelete:
+		actions = append(actions, change.Action)
+	case json.ActionReplace:
+		actions = append(actions, json.ActionDelete, json.ActionCreate)
+	}
+	return actions
+}
+
+// setID sets the id of the resource of the operation, unless it isn't told by the hook.
+func setID(info *state.ResourceOperationInfo, key, value string) {
+	if value == "" {
+		return
+	}
+	info.IDKey = key
+	info.IDValue = value
+}
+
+func locator(addr json.ResourceAddr, action string) state.ResourceOperationInfoLocator {
+	return state.ResourceOperationInfoLocator{
+		Module:       addr.Module,
+		ResourceAddr: addr.Addr,
+		Action:       action,
+	}
+}
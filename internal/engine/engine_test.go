@@ -0,0 +1,269 @@
+package engine_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/magodo/pipeform/internal/engine"
+	"github.com/magodo/pipeform/internal/enginetest"
+	"github.com/magodo/pipeform/internal/history"
+	"github.com/magodo/pipeform/internal/state"
+	"github.com/magodo/pipeform/terraform/views/json"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEngineApply(t *testing.T) {
+	e, events := enginetest.Apply(t, "apply.jsonl")
+
+	require.Equal(t, "Terraform 1.10.3", e.Version())
+	require.Equal(t, "2025-01-10T10:00:01Z", e.StartTime().Format(time.RFC3339))
+	require.Equal(t, engine.PhaseSummary, e.Phase())
+	require.Equal(t, []engine.Phase{engine.PhaseIdle, engine.PhaseRefresh, engine.PhasePlan, engine.PhaseApply, engine.PhaseSummary}, e.VisitedPhases())
+	var phaseStartTimes []string
+	for _, t := range e.PhaseStartTimes() {
+		phaseStartTimes = append(phaseStartTimes, t.Format(time.TimeOnly))
+	}
+	require.Equal(t, []string{"10:00:01", "10:00:02", "10:00:04", "10:00:08", "10:00:18"}, phaseStartTimes)
+	require.Equal(t, json.OperationApplied, e.Operation())
+	require.Equal(t, 4, e.TotalCount())
+	require.Equal(t, &json.ChangeSummary{Add: 3, Remove: 1, Operation: json.OperationApplied}, e.ChangeSummary())
+	require.Equal(t, 4, e.DoneCount())
+
+	require.Equal(t, 1, e.RefreshInfos().Len())
+	require.Len(t, e.PlanInfos(), 3)
+	// All the planned operations have started
+	require.Empty(t, e.ApplyInfos().Pending())
+
+	applyInfos := e.ApplyInfos()
+	require.Equal(t, 4, applyInfos.Len())
+	require.Empty(t, applyInfos.Running())
+	require.Len(t, applyInfos.Errored(), 1)
+	require.Equal(t, "module.m.null_resource.bad", applyInfos.Errored()[0].Loc.ResourceAddr)
+	// The error diagnostic is linked to the errored operation via its address
+	require.Len(t, applyInfos.Errored()[0].Diags, 1)
+	require.Equal(t, "module.m.null_resource.bad", applyInfos.Errored()[0].Diags[0].Address)
+	dog := applyInfos.Find(state.ResourceOperationInfoLocator{ResourceAddr: "random_pet.dog", Action: "create"})
+	require.NotNil(t, dog)
+	require.Equal(t, 4, dog.Idx)
+	require.Equal(t, state.ResourceOperationStatusComplete, dog.Status)
+	// The id of the created resource is told by the OperationComplete hook
+	require.Equal(t, "good-dog", dog.IDValue)
+	dogDeletion := applyInfos.Find(state.ResourceOperationInfoLocator{ResourceAddr: "random_pet.dog", Action: "delete"})
+	require.NotNil(t, dogDeletion)
+	require.Equal(t, "id", dogDeletion.IDKey)
+	require.Equal(t, "smart-lizard", dogDeletion.IDValue)
+
+	require.True(t, e.Diags().HasError())
+
+	outputs := e.OutputInfos()
+	require.Len(t, outputs, 2)
+	require.Equal(t, "cat", outputs[0].Name)
+	require.True(t, outputs[0].Sensitive)
+	require.Equal(t, "pet", outputs[1].Name)
+
+	var phaseChanges []engine.PhaseChangedEvent
+	var progresses []engine.ProgressEvent
+	var operations int
+	var diagEvents []engine.DiagnosticEvent
+	for _, ev := range events {
+		switch ev := ev.(type) {
+		case engine.DiagnosticEvent:
+			diagEvents = append(diagEvents, ev)
+		case engine.PhaseChangedEvent:
+			phaseChanges = append(phaseChanges, ev)
+		case engine.ProgressEvent:
+			progresses = append(progresses, ev)
+		case engine.OperationEvent:
+			operations++
+		}
+	}
+	require.Len(t, phaseChanges, 4)
+	require.Len(t, diagEvents, 1)
+	require.Same(t, applyInfos.Errored()[0], diagEvents[0].Info)
+	require.Equal(t, engine.PhaseChangedEvent{From: engine.PhaseApply, To: engine.PhaseSummary}, phaseChanges[3])
+	// refresh: start + complete, apply: 4 * (start + complete) + progress
+	require.Equal(t, 11, operations)
+	require.Equal(t, []engine.ProgressEvent{
+		{Total: 4, Done: 0},
+		{Total: 4, Done: 1},
+		{Total: 4, Done: 2},
+		{Total: 4, Done: 3},
+		{Total: 4, Done: 4},
+		{Total: 4, Done: 4},
+	}, progresses)
+}
+
+func TestEngineApplyPlanFile(t *testing.T) {
+	e, _ := enginetest.Apply(t, "apply_plan_file.jsonl")
+
+	// The total count is counted from the planned changes, as there is no change summary.
+	require.Equal(t, 3, e.TotalCount())
+	require.Equal(t, 1, e.DoneCount())
+	require.Equal(t, engine.PhaseApply, e.Phase())
+
+	// The replace is split into a delete and a create, and the import is planned even though the action is "noop".
+	var pending []state.ResourceOperationInfoLocator
+	for _, info := range e.ApplyInfos().Pending() {
+		require.Equal(t, state.ResourceOperationStatusPending, info.Status)
+		pending = append(pending, info.Loc)
+	}
+	require.Equal(t, []state.ResourceOperationInfoLocator{
+		{ResourceAddr: "random_pet.dog", Action: "delete"},
+		{ResourceAddr: "random_pet.dog", Action: "create"},
+		{ResourceAddr: "random_pet.imported", Action: "import"},
+	}, pending)
+	require.Equal(t, 1, e.ApplyInfos().Len())
+}
+
+func TestEngineTest(t *testing.T) {
+	e, events := enginetest.Apply(t, "test.jsonl")
+
+	require.Equal(t, engine.PhaseTest, e.Phase())
+	total, done := e.TestInfos().RunCount()
+	require.Equal(t, 2, total)
+	require.Equal(t, 2, done)
+
+	run := e.TestInfos().Find("main.tftest.hcl", "check")
+	require.NotNil(t, run)
+	require.Equal(t, json.TestFail, run.Status)
+	// The elapsed time reported by Terraform is preferred to the timestamps
+	require.Equal(t, 2987*time.Millisecond, run.Duration(time.Time{}))
+	setup := e.TestInfos().Find("main.tftest.hcl", "setup")
+	require.NotNil(t, setup)
+	require.Equal(t, 2*time.Second, setup.Duration(time.Time{}))
+
+	var progresses []engine.ProgressEvent
+	for _, ev := range events {
+		if ev, ok := ev.(engine.ProgressEvent); ok {
+			progresses = append(progresses, ev)
+		}
+	}
+	require.Equal(t, engine.ProgressEvent{Total: 2, Done: 2}, progresses[len(progresses)-1])
+}
+
+func TestEngineUnknown(t *testing.T) {
+	e, events := enginetest.Apply(t, "unknown.jsonl")
+
+	// The unsupported version is only warned once
+	var warnings []engine.UnsupportedVersionEvent
+	for _, ev := range events {
+		if ev, ok := ev.(engine.UnsupportedVersionEvent); ok {
+			warnings = append(warnings, ev)
+		}
+	}
+	require.Len(t, warnings, 1)
+	require.Equal(t, "1.3", warnings[0].UI)
+	require.Len(t, e.Diags(), 1)
+	require.False(t, e.Diags().HasError())
+
+	require.Equal(t, engine.PhaseIdle, e.Phase())
+}
+
+func TestEngineProvision(t *testing.T) {
+	e, events := enginetest.Apply(t, "provision.jsonl")
+
+	applyInfos := e.ApplyInfos()
+	ok := applyInfos.Find(state.ResourceOperationInfoLocator{ResourceAddr: "null_resource.ok", Action: "create"})
+	require.NotNil(t, ok)
+	require.Equal(t, state.ResourceOperationStatusComplete, ok.Status)
+	require.Len(t, ok.Provisioners, 1)
+	require.Equal(t, "local-exec", ok.Provisioners[0].Provisioner)
+	require.Equal(t, state.ResourceOperationStatusComplete, ok.Provisioners[0].Status)
+	require.Equal(t, []string{`Executing: ["/bin/sh" "-c" "echo hello"]`, "hello"}, ok.Provisioners[0].Output)
+	require.False(t, ok.HasErroredProvisioner())
+
+	bad := applyInfos.Find(state.ResourceOperationInfoLocator{ResourceAddr: "null_resource.bad", Action: "create"})
+	require.NotNil(t, bad)
+	require.Equal(t, state.ResourceOperationStatusErrored, bad.Status)
+	require.True(t, bad.HasErroredProvisioner())
+	require.Equal(t, []string{"boom"}, bad.Provisioners[0].Output)
+
+	// The provisioner steps don't count as operations
+	require.Equal(t, 2, e.DoneCount())
+
+	// start + progress * 3 + complete + start + errored
+	var provisionerEvents int
+	for _, ev := range events {
+		if _, ok := ev.(engine.ProvisionerEvent); ok {
+			provisionerEvents++
+		}
+	}
+	require.Equal(t, 7, provisionerEvents)
+}
+
+func TestEngineDrift(t *testing.T) {
+	e, events := enginetest.Apply(t, "drift.jsonl")
+
+	require.Equal(t, []engine.Phase{engine.PhaseIdle, engine.PhaseRefresh, engine.PhaseDrift, engine.PhasePlan}, e.VisitedPhases())
+
+	drifts := e.DriftInfos()
+	require.Len(t, drifts, 2)
+	require.Equal(t, "random_pet.dog", drifts[0].Resource.Addr)
+	require.Equal(t, json.ActionUpdate, drifts[0].Action)
+	require.Equal(t, "module.m", drifts[1].Resource.Module)
+	require.Equal(t, json.ActionDelete, drifts[1].Action)
+
+	var driftEvents int
+	for _, ev := range events {
+		if _, ok := ev.(engine.DriftEvent); ok {
+			driftEvents++
+		}
+	}
+	require.Equal(t, 2, driftEvents)
+}
+
+func TestEngineAux(t *testing.T) {
+	e, events := enginetest.Apply(t, "aux.jsonl")
+
+	// The data source read during the plan doesn't enter the apply phase
+	require.Equal(t, []engine.Phase{engine.PhaseIdle, engine.PhasePlan, engine.PhaseApply, engine.PhaseSummary}, e.VisitedPhases())
+
+	require.Equal(t, 1, e.TotalCount())
+	require.Equal(t, 1, e.DoneCount())
+	require.Equal(t, 1, e.ApplyInfos().Len())
+
+	aux := e.AuxInfos()
+	require.Equal(t, 5, aux.Len())
+	require.Equal(t, 5, e.AuxDoneCount())
+	require.NotNil(t, aux.Find(state.ResourceOperationInfoLocator{ResourceAddr: "data.http.ip", Action: "read"}))
+
+	var progresses []engine.ProgressEvent
+	for _, ev := range events {
+		if ev, ok := ev.(engine.ProgressEvent); ok {
+			progresses = append(progresses, ev)
+			require.LessOrEqual(t, ev.Done, ev.Total)
+		}
+	}
+	require.Equal(t, engine.ProgressEvent{Total: 1, Done: 1}, progresses[len(progresses)-1])
+}
+
+func TestEngineHistory(t *testing.T) {
+	dir := t.TempDir()
+	h, err := history.Load(dir, "/project")
+	require.NoError(t, err)
+	require.NoError(t, h.Ingest([]byte(strings.Join([]string{
+		"0,0,refresh,refresh,,random_pet,dog,null,complete,1",
+		"0,0,apply,create,,random_pet,cat,null,complete,5",
+		"0,0,apply,create,,random_pet,cat,null,complete,7",
+	}, "\n"))))
+	require.NoError(t, h.Save())
+	h, err = history.Load(dir, "/project")
+	require.NoError(t, err)
+
+	e, _ := enginetest.Apply(t, "apply.jsonl", engine.WithHistory(h))
+
+	require.Equal(t, &state.ExpectedDuration{Median: time.Second, P90: time.Second}, e.RefreshInfos().All()[0].Expected)
+
+	expected := map[string]*state.ExpectedDuration{}
+	for _, info := range e.ApplyInfos().All() {
+		expected[info.Loc.Action+" "+info.Loc.ResourceAddr] = info.Expected
+	}
+	require.Equal(t, map[string]*state.ExpectedDuration{
+		"delete random_pet.dog": nil,
+		// The dog has no history of create, the cat's is used as of the same resource type
+		"create random_pet.dog":             {Median: 5 * time.Second, P90: 7 * time.Second},
+		"create random_pet.cat":             {Median: 5 * time.Second, P90: 7 * time.Second},
+		"create module.m.null_resource.bad": nil,
+	}, expected)
+}
@@ -0,0 +1,100 @@
+package engine
+
+import (
+	"github.com/magodo/pipeform/internal/state"
+	"github.com/magodo/pipeform/terraform/views/json"
+)
+
+// Event is emitted by the engine for each change of the state.
+type Event interface {
+	isEvent()
+}
+
+// Stage is the stage of the resource operations.
+type Stage string
+
+const (
+	StageRefresh Stage = "refresh"
+	StageApply   Stage = "apply"
+	// StageAux is for the operations that aren't counted in the change summary, i.e. the data source reads
+	// and the ephemeral resource operations (open, renew and close).
+	StageAux Stage = "aux"
+)
+
+// PhaseChangedEvent is emitted when the run enters a new phase.
+type PhaseChangedEvent struct {
+	From Phase
+	To   Phase
+}
+
+// DiagnosticEvent is emitted when a warning or error diagnostic is recorded.
+// The Info is the resource operation that the diagnostic is linked to via its address, if any.
+type DiagnosticEvent struct {
+	Diag json.Diagnostic
+	Info *state.ResourceOperationInfo
+}
+
+// UnsupportedVersionEvent is emitted once when the UI protocol version is newer than the supported one.
+// The Diag is the warning diagnostic recorded for it.
+type UnsupportedVersionEvent struct {
+	UI   string
+	Diag json.Diagnostic
+}
+
+// DriftEvent is emitted when a resource drift is recorded.
+type DriftEvent struct {
+	Info *state.DriftInfo
+}
+
+// PlannedChangeEvent is emitted when a planned change is recorded.
+type PlannedChangeEvent struct {
+	Info *state.PlanInfo
+}
+
+// OperationEvent is emitted when a resource operation starts, progresses, completes or errors.
+// The status of the info tells which one.
+type OperationEvent struct {
+	Stage Stage
+	Info  *state.ResourceOperationInfo
+}
+
+// ProvisionerEvent is emitted when a provisioner step of a resource operation starts, outputs, completes or errors.
+// The status of the provisioner tells which one.
+type ProvisionerEvent struct {
+	Info        *state.ResourceOperationInfo
+	Provisioner *state.ProvisionerInfo
+}
+
+// ProgressEvent is emitted when the count of the (done) operations of the apply, or the run blocks
+// of the test changes.
+type ProgressEvent struct {
+	Total int
+	Done  int
+}
+
+// OutputsEvent is emitted when the outputs are recorded.
+type OutputsEvent struct {
+	Infos state.OutputInfos
+}
+
+// TestEvent is emitted when a test file or run block is updated.
+type TestEvent struct {
+	Info *state.TestInfo
+}
+
+// RawLineEvent is emitted when a line that isn't a Terraform message is recorded.
+type RawLineEvent struct {
+	Line string
+}
+
+func (PhaseChangedEvent) isEvent()       {}
+func (DiagnosticEvent) isEvent()         {}
+func (UnsupportedVersionEvent) isEvent() {}
+func (DriftEvent) isEvent()              {}
+func (PlannedChangeEvent) isEvent()      {}
+func (OperationEvent) isEvent()          {}
+func (ProvisionerEvent) isEvent()        {}
+func (ProgressEvent) isEvent()           {}
+func (OutputsEvent) isEvent()            {}
+func (TestEvent) isEvent()               {}
+func (RawLineEvent) isEvent()            {}
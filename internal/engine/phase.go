@@ -0,0 +1,129 @@
+package engine
+
+import (
+	"github.com/magodo/pipeform/terraform/views"
+	"github.com/magodo/pipeform/terraform/views/json"
+)
+
+// Phase is the phase of the run, e.g. refresh, plan or apply.
+type Phase int
+
+const (
+	PhaseUnknown Phase = iota
+	PhaseIdle
+	PhaseRefresh
+	PhaseDrift
+	PhasePlan
+	PhaseApply
+	PhaseSummary
+	PhaseTest
+)
+
+func (s Phase) String() string {
+	switch s {
+	case PhaseIdle:
+		return "IDLE"
+	case PhaseRefresh:
+		return "REFRESH"
+	case PhaseDrift:
+		return "DRIFT"
+	case PhasePlan:
+		return "PLAN"
+	case PhaseApply:
+		return "APPLY"
+	case PhaseSummary:
+		return "SUMMARY"
+	case PhaseTest:
+		return "TEST"
+	default:
+		return "UNKNOWN"
+	}
+}
+
+// NextPhase returns the phase after the message, and whether the phase changes.
+func (s Phase) NextPhase(msg views.Message) (Phase, bool) {
+	switch s {
+	case PhaseIdle:
+		switch msg.BaseMessage().Type {
+		case json.MessageRefreshStart:
+			return PhaseRefresh, true
+		case json.MessageResourceDrift:
+			return PhaseDrift, true
+		case json.MessagePlannedChange:
+			return PhasePlan, true
+		case json.MessageApplyStart:
+			if !isAuxOperation(msg) {
+				return PhaseApply, true
+			}
+		case json.MessageTestAbstract, json.MessageTestFile, json.MessageTestRun:
+			// The terraform test runs plan/apply for each run block, whose messages are ignored
+			// for the phase transition once entered the test state.
+			return PhaseTest, true
+		case json.MessageChangeSummary:
+			// There are two change summary messages, one after plan, one after apply.
+			// We only handle the one after apply, as the one after plan is less interesting to show.
+			if msg.(views.ChangeSummaryMsg).Changes.Operation == json.OperationApplied {
+				return PhaseSummary, true
+			}
+		}
+
+	case PhaseRefresh:
+		switch msg.BaseMessage().Type {
+		case json.MessageResourceDrift:
+			return PhaseDrift, true
+		case json.MessagePlannedChange:
+			return PhasePlan, true
+		case json.MessageChangeSummary:
+			if msg.(views.ChangeSummaryMsg).Changes.Operation == json.OperationApplied {
+				return PhaseSummary, true
+			}
+		}
+
+	case PhaseDrift:
+		switch msg.BaseMessage().Type {
+		case json.MessagePlannedChange:
+			return PhasePlan, true
+		case json.MessageApplyStart:
+			if !isAuxOperation(msg) {
+				return PhaseApply, true
+			}
+		case json.MessageChangeSummary:
+			if msg.(views.ChangeSummaryMsg).Changes.Operation == json.OperationApplied {
+				return PhaseSummary, true
+			}
+		}
+
+	case PhasePlan:
+		switch msg.BaseMessage().Type {
+		case json.MessageApplyStart:
+			if !isAuxOperation(msg) {
+				return PhaseApply, true
+			}
+		case json.MessageChangeSummary:
+			if msg.(views.ChangeSummaryMsg).Changes.Operation == json.OperationApplied {
+				return PhaseSummary, true
+			}
+		}
+
+	case PhaseApply:
+		switch msg.BaseMessage().Type {
+		case json.MessageChangeSummary:
+			return PhaseSummary, true
+		}
+	}
+
+	return s, false
+}
+
+// isAuxOperation tells whether the hook message is of an operation of the aux stage, e.g. a data source read,
+// which happens during the plan as well.
+func isAuxOperation(msg views.Message) bool {
+	hook, ok := msg.(views.HookMsg)
+	if !ok {
+		return false
+	}
+	if h, ok := hook.OperationStart(); ok {
+		return IsAuxAction(h.Action)
+	}
+	return false
+}
@@ -0,0 +1,48 @@
+// Package enginetest provides the recorded Terraform streams for the tests, together with the engine that has
+// applied them.
+package enginetest
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/magodo/pipeform/internal/engine"
+	"github.com/magodo/pipeform/internal/log"
+	"github.com/magodo/pipeform/internal/reader"
+	"github.com/stretchr/testify/require"
+)
+
+// Recording returns the content of the recorded stream, e.g. "apply.jsonl".
+func Recording(t testing.TB, name string) []byte {
+	// The recordings aren't embedded, as "aux" is a reserved file name on Windows, which can't be embedded.
+	_, file, _, ok := runtime.Caller(0)
+	require.True(t, ok)
+	b, err := os.ReadFile(filepath.Join(filepath.Dir(file), "testdata", name))
+	require.NoError(t, err)
+	return b
+}
+
+// Apply applies all the messages of the recorded stream to a new engine, and returns the engine together with
+// the emitted events.
+func Apply(t testing.TB, name string, opts ...engine.Option) (*engine.Engine, []engine.Event) {
+	logger, err := log.NewLogger("", "")
+	require.NoError(t, err)
+
+	e := engine.New(logger, time.Time{}, opts...)
+	r := reader.NewReader(bytes.NewReader(Recording(t, name)), io.Discard)
+	var events []engine.Event
+	for {
+		msg, err := r.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		events = append(events, e.Apply(msg)...)
+	}
+	return e, events
+}
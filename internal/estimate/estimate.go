@@ -0,0 +1,134 @@
+// Package estimate estimates the remaining time and the throughput of the resource operations.
+package estimate
+
+import (
+	"time"
+
+	"github.com/magodo/pipeform/internal/state"
+)
+
+// Estimate is the estimation of the resource operations at a moment.
+type Estimate struct {
+	// Remaining is the estimated remaining time, only valid if OK is true.
+	Remaining time.Duration
+	OK        bool
+
+	// Rate is the count of the done (either complete or errored) operations per minute.
+	Rate float64
+}
+
+// New estimates the resource operations against now. The total is the count of the operations to run, the
+// remaining time can't be estimated if it is unknown (i.e. 0), or there is no complete operation yet.
+//
+// The remaining time of each operation is based on its expected duration from the history, if any. Otherwise, the
+// average duration of the complete operations of the same resource type (or all the complete operations, for an
+// unseen type) is used. The operations not yet started are assumed to run with the same concurrency as the ones in
+// flight.
+func New(infos state.ResourceOperationInfos, total int, now time.Time) Estimate {
+	var (
+		est Estimate
+
+		firstStart time.Time
+		doneCnt    int
+		running    []*state.ResourceOperationInfo
+
+		sum      time.Duration
+		cnt      int
+		typeSums = map[string]time.Duration{}
+		typeCnts = map[string]int{}
+	)
+
+	for _, info := range infos.All() {
+		if firstStart.IsZero() || info.StartTime.Before(firstStart) {
+			firstStart = info.StartTime
+		}
+		switch info.Status {
+		case state.ResourceOperationStatusComplete:
+			doneCnt++
+			dur := info.EndTime.Sub(info.StartTime)
+			sum += dur
+			cnt++
+			typeSums[info.RawResourceAddr.ResourceType] += dur
+			typeCnts[info.RawResourceAddr.ResourceType]++
+		case state.ResourceOperationStatusErrored:
+			doneCnt++
+		default:
+			running = append(running, info)
+		}
+	}
+
+	if elapsed := now.Sub(firstStart); !firstStart.IsZero() && elapsed >= time.Second {
+		est.Rate = float64(doneCnt) / elapsed.Minutes()
+	}
+
+	if total == 0 || cnt == 0 {
+		return est
+	}
+
+	average := func(info *state.ResourceOperationInfo) time.Duration {
+		if info.Expected != nil {
+			return info.Expected.Median
+		}
+		if n := typeCnts[info.RawResourceAddr.ResourceType]; n != 0 {
+			return typeSums[info.RawResourceAddr.ResourceType] / time.Duration(n)
+		}
+		return sum / time.Duration(cnt)
+	}
+
+	// The remaining time of the operations in flight
+	var inFlight, longest time.Duration
+	for _, info := range running {
+		rem := max(average(info)-now.Sub(info.StartTime), 0)
+		inFlight += rem
+		longest = max(longest, rem)
+	}
+
+	// The time of the operations not yet started, where the planned ones are known by resource types
+	var queued time.Duration
+	pending := infos.Pending()
+	for _, info := range pending {
+		queued += average(info)
+	}
+	if unknown := total - infos.Len() - len(pending); unknown > 0 {
+		queued += time.Duration(unknown) * (sum / time.Duration(cnt))
+	}
+
+	parallelism := max(len(running), 1)
+	est.Remaining = max(longest, (inFlight+queued)/time.Duration(parallelism)).Truncate(time.Second)
+	est.OK = true
+	return est
+}
+
+// Throughput returns the count of the operations done in each of the n buckets of the size, where the last
+// bucket ends at now.
+func Throughput(infos state.ResourceOperationInfos, now time.Time, n int, size time.Duration) []int {
+	counts := make([]int, n)
+	start := now.Add(-time.Duration(n) * size)
+	for _, info := range infos.All() {
+		if info.EndTime.IsZero() || info.EndTime.Before(start) || info.EndTime.After(now) {
+			continue
+		}
+		idx := min(int(info.EndTime.Sub(start)/size), n-1)
+		counts[idx]++
+	}
+	return counts
+}
+
+var sparks = []rune("▁▂▃▄▅▆▇█")
+
+// Sparkline renders the counts as a sparkline, scaled to the maximum count.
+func Sparkline(counts []int) string {
+	var peak int
+	for _, c := range counts {
+		peak = max(peak, c)
+	}
+	out := make([]rune, len(counts))
+	for i, c := range counts {
+		if peak == 0 {
+			out[i] = sparks[0]
+			continue
+		}
+		out[i] = sparks[c*(len(sparks)-1)/peak]
+	}
+	return string(out)
+}
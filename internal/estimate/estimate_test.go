@@ -0,0 +1,81 @@
+package estimate_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/magodo/pipeform/internal/estimate"
+	"github.com/magodo/pipeform/internal/state"
+	"github.com/magodo/pipeform/terraform/views/json"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNew(t *testing.T) {
+	t0 := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	var infos state.ResourceOperationInfos
+	add := func(addr, typ string, start, end int) {
+		info := &state.ResourceOperationInfo{
+			Idx:             infos.Len() + 1,
+			RawResourceAddr: json.ResourceAddr{Addr: addr, ResourceType: typ},
+			Loc:             state.ResourceOperationInfoLocator{ResourceAddr: addr, Action: "create"},
+			Status:          state.ResourceOperationStatusStart,
+			StartTime:       t0.Add(time.Duration(start) * time.Second),
+		}
+		if end >= 0 {
+			info.Status = state.ResourceOperationStatusComplete
+			info.EndTime = t0.Add(time.Duration(end) * time.Second)
+		}
+		infos.Add(info)
+	}
+	pending := func(addr, typ string) {
+		infos.AddPending(&state.ResourceOperationInfo{
+			RawResourceAddr: json.ResourceAddr{Addr: addr, ResourceType: typ},
+			Loc:             state.ResourceOperationInfoLocator{ResourceAddr: addr, Action: "create"},
+			Status:          state.ResourceOperationStatusPending,
+		})
+	}
+
+	// Nothing is complete yet
+	add("db.a", "db", 0, -1)
+	require.False(t, estimate.New(infos, 4, t0.Add(10*time.Second)).OK)
+
+	// A database takes 100s, while an IAM binding takes 2s
+	add("iam.a", "iam", 0, 2)
+	add("db.b", "db", 0, 100)
+	add("db.a2", "db", 60, -1)
+	pending("iam.b", "iam")
+
+	now := t0.Add(120 * time.Second)
+	est := estimate.New(infos, 6, now)
+	require.True(t, est.OK)
+	// In flight: db.a (0s left, overdue) and db.a2 (40s left)
+	// Queued: iam.b (2s) and one unknown operation (51s on average)
+	// max(40s, (40s + 2s + 51s) / 2)
+	require.Equal(t, 46*time.Second, est.Remaining)
+	require.Equal(t, float64(2)/2, est.Rate)
+
+	// The total is unknown, e.g. for the refresh
+	est = estimate.New(infos, 0, now)
+	require.False(t, est.OK)
+	require.Equal(t, float64(2)/2, est.Rate)
+}
+
+func TestThroughput(t *testing.T) {
+	t0 := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	var infos state.ResourceOperationInfos
+	for i, end := range []int{1, 5, 6, 25, 29, 30} {
+		infos.Add(&state.ResourceOperationInfo{
+			Loc:       state.ResourceOperationInfoLocator{ResourceAddr: string(rune('a' + i))},
+			Status:    state.ResourceOperationStatusComplete,
+			StartTime: t0,
+			EndTime:   t0.Add(time.Duration(end) * time.Second),
+		})
+	}
+	counts := estimate.Throughput(infos, t0.Add(30*time.Second), 3, 10*time.Second)
+	require.Equal(t, []int{3, 0, 3}, counts)
+	require.Equal(t, "█▁█", estimate.Sparkline(counts))
+	require.Equal(t, "▁▄█", estimate.Sparkline([]int{0, 1, 2}))
+	require.Equal(t, "▁▁", estimate.Sparkline([]int{0, 0}))
+}
@@ -0,0 +1,301 @@
+// Package history stores the timing of the operations of the past runs, from which the durations of the same
+// operations of the current run are expected.
+//
+// The history of each project is stored as a CSV file of the same format as the --time-csv output, only the complete
+// operations of the refresh and the apply stages are kept, up to maxSamples for each operation.
+package history
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/magodo/pipeform/internal/state"
+)
+
+const (
+	// maxSamples is the count of the latest samples kept for each operation
+	maxSamples = 20
+
+	// fieldCount is the count of the fields of each row of the time csv
+	fieldCount = 10
+)
+
+// DefaultDir returns the default history directory, i.e. $XDG_DATA_HOME/pipeform, which falls back to
+// $HOME/.local/share/pipeform.
+func DefaultDir() (string, error) {
+	if dir := os.Getenv("XDG_DATA_HOME"); dir != "" {
+		return filepath.Join(dir, "pipeform"), nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".local", "share", "pipeform"), nil
+}
+
+// key identifies an operation of a resource across the runs.
+type key struct {
+	stage        string
+	action       string
+	module       string
+	resourceType string
+	resourceName string
+	resourceKey  string
+}
+
+// typeKey identifies the operations of a resource type across the runs, which is used for the resources that have
+// no history, e.g. a newly added one.
+type typeKey struct {
+	stage        string
+	action       string
+	resourceType string
+}
+
+func (k key) typeKey() typeKey {
+	return typeKey{stage: k.stage, action: k.action, resourceType: k.resourceType}
+}
+
+type History struct {
+	path string
+
+	// keys are in the first seen order, to keep the history file stable
+	keys []key
+	// rows are the time csv records of each operation, from the oldest to the latest
+	rows map[key][][]string
+
+	// ingested are the time csv records of the ingested runs, which are merged into the history file on save
+	ingested [][]string
+
+	durations     map[key][]time.Duration
+	typeDurations map[typeKey][]time.Duration
+}
+
+// fileName returns the name of the history file of the project, which is named after the hash of the project
+// directory, so that the same addresses of the unrelated projects aren't mixed up.
+func fileName(project string) string {
+	sum := sha256.Sum256([]byte(project))
+	return "timings-" + hex.EncodeToString(sum[:8]) + ".csv"
+}
+
+func newHistory(path string) *History {
+	return &History{
+		path:          path,
+		rows:          map[key][][]string{},
+		durations:     map[key][]time.Duration{},
+		typeDurations: map[typeKey][]time.Duration{},
+	}
+}
+
+// Load loads the history of the project (i.e. the working directory of the run) from the directory.
+// A non-existing history is regarded as empty.
+func Load(dir, project string) (*History, error) {
+	h := newHistory(filepath.Join(dir, fileName(project)))
+	if err := h.read(); err != nil {
+		return nil, err
+	}
+	for _, k := range h.keys {
+		for _, row := range h.rows[k] {
+			_, dur, _ := parseRow(row)
+			h.durations[k] = append(h.durations[k], dur)
+			h.typeDurations[k.typeKey()] = append(h.typeDurations[k.typeKey()], dur)
+		}
+	}
+	return h, nil
+}
+
+// read adds the records of the history file, if exists.
+func (h *History) read() error {
+	b, err := os.ReadFile(h.path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return fmt.Errorf("reading history: %v", err)
+	}
+	records, err := parse(b)
+	if err != nil {
+		return fmt.Errorf("parsing history: %v", err)
+	}
+	h.add(records)
+	return nil
+}
+
+// Ingest adds the operations of a run, in the format of the --time-csv output. The expectations aren't affected
+// until the history is saved and loaded again.
+func (h *History) Ingest(timeCsv []byte) error {
+	records, err := parse(timeCsv)
+	if err != nil {
+		return fmt.Errorf("parsing time csv: %v", err)
+	}
+	h.ingested = append(h.ingested, records...)
+	return nil
+}
+
+// Save merges the ingested runs into the history file, which is created if not exists. The history file is
+// re-read under a file lock, so that the concurrent runs don't drop the samples of each other.
+func (h *History) Save() error {
+	dir := filepath.Dir(h.path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("creating history directory: %v", err)
+	}
+
+	unlock, err := lock(h.path + ".lock")
+	if err != nil {
+		return fmt.Errorf("locking history: %v", err)
+	}
+	defer unlock()
+
+	latest := newHistory(h.path)
+	if err := latest.read(); err != nil {
+		return err
+	}
+	latest.add(h.ingested)
+
+	records := [][]string{header}
+	for _, k := range latest.keys {
+		records = append(records, latest.rows[k]...)
+	}
+	var buf bytes.Buffer
+	// Writing to the buffer never fails
+	csv.NewWriter(&buf).WriteAll(records)
+
+	// Write to a temporary file then rename, so that the history is never left half written.
+	tmp, err := os.CreateTemp(dir, filepath.Base(h.path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("writing history: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(buf.Bytes()); err != nil {
+		tmp.Close()
+		return fmt.Errorf("writing history: %v", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("writing history: %v", err)
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return fmt.Errorf("writing history: %v", err)
+	}
+	if err := os.Rename(tmp.Name(), h.path); err != nil {
+		return fmt.Errorf("writing history: %v", err)
+	}
+
+	// The ingested runs are in the history file now
+	h.ingested = nil
+	return nil
+}
+
+// lock acquires the exclusive lock of the lock file, it blocks until the other runs release it.
+func lock(path string) (unlock func(), err error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, err
+	}
+	if err := lockFile(f); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return func() {
+		unlockFile(f)
+		f.Close()
+	}, nil
+}
+
+// Expected returns the expected duration of the operation of the stage (i.e. "refresh" or "apply"), based on the
+// same operation of the history runs, or the operations of the same resource type if the resource has no history.
+// It returns nil if neither exists.
+func (h *History) Expected(stage string, info *state.ResourceOperationInfo) *state.ExpectedDuration {
+	if h == nil {
+		return nil
+	}
+	resourceKey, _ := info.RawResourceAddr.ResourceKey.MarshalJSON()
+	k := key{
+		stage:        stage,
+		action:       info.Loc.Action,
+		module:       info.Loc.Module,
+		resourceType: info.RawResourceAddr.ResourceType,
+		resourceName: info.RawResourceAddr.ResourceName,
+		resourceKey:  string(resourceKey),
+	}
+	durations := h.durations[k]
+	if len(durations) == 0 {
+		durations = h.typeDurations[k.typeKey()]
+	}
+	if len(durations) == 0 {
+		return nil
+	}
+	return &state.ExpectedDuration{
+		Median: percentile(durations, 50),
+		P90:    percentile(durations, 90),
+	}
+}
+
+// header is the header of the time csv
+var header = []string{"Start Timestamp", "End Timestamp", "Stage", "Action", "Module", "Resource Type", "Resource Name", "Resource Key", "Status", "Duration (sec)"}
+
+// parse parses the records of the time csv, it fails if the time csv is malformed, e.g. a row doesn't have all
+// the fields.
+func parse(timeCsv []byte) ([][]string, error) {
+	r := csv.NewReader(bytes.NewReader(timeCsv))
+	r.FieldsPerRecord = fieldCount
+	return r.ReadAll()
+}
+
+// add adds the complete operations of the refresh and the apply stages in the time csv records.
+func (h *History) add(records [][]string) {
+	for _, row := range records {
+		k, _, ok := parseRow(row)
+		if !ok {
+			continue
+		}
+		if _, ok := h.rows[k]; !ok {
+			h.keys = append(h.keys, k)
+		}
+		rows := append(h.rows[k], row)
+		if len(rows) > maxSamples {
+			rows = rows[len(rows)-maxSamples:]
+		}
+		h.rows[k] = rows
+	}
+}
+
+// parseRow parses the time csv record, it returns false if the record isn't a complete operation of the refresh or
+// the apply stage (e.g. the header).
+func parseRow(fields []string) (key, time.Duration, bool) {
+	if stage := fields[2]; stage != "refresh" && stage != "apply" {
+		return key{}, 0, false
+	}
+	if fields[8] != string(state.ResourceOperationStatusComplete) {
+		return key{}, 0, false
+	}
+	sec, err := strconv.ParseInt(fields[9], 10, 64)
+	if err != nil || sec < 0 {
+		return key{}, 0, false
+	}
+	k := key{
+		stage:        fields[2],
+		action:       fields[3],
+		module:       fields[4],
+		resourceType: fields[5],
+		resourceName: fields[6],
+		resourceKey:  fields[7],
+	}
+	return k, time.Duration(sec) * time.Second, true
+}
+
+// percentile returns the p-th percentile of the durations, by the nearest-rank method.
+func percentile(durations []time.Duration, p float64) time.Duration {
+	sorted := slices.Clone(durations)
+	slices.Sort(sorted)
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	return sorted[max(rank, 1)-1]
+}
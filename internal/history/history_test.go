@@ -0,0 +1,168 @@
+package history_test
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/magodo/pipeform/internal/history"
+	"github.com/magodo/pipeform/internal/state"
+	"github.com/magodo/pipeform/terraform/views/json"
+	"github.com/stretchr/testify/require"
+)
+
+func newInfo(typ, name, action string) *state.ResourceOperationInfo {
+	return &state.ResourceOperationInfo{
+		RawResourceAddr: json.ResourceAddr{
+			Addr:         typ + "." + name,
+			ResourceType: typ,
+			ResourceName: name,
+		},
+		Loc: state.ResourceOperationInfoLocator{
+			ResourceAddr: typ + "." + name,
+			Action:       action,
+		},
+	}
+}
+
+// historyFile returns the only history file in the directory.
+func historyFile(t *testing.T, dir string) string {
+	files, err := filepath.Glob(filepath.Join(dir, "timings-*.csv"))
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+	return files[0]
+}
+
+func TestHistory(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "pipeform")
+
+	h, err := history.Load(dir, "/project")
+	require.NoError(t, err)
+	require.Nil(t, h.Expected("apply", newInfo("random_pet", "dog", "create")))
+
+	// Ingest 10 runs, where the dog takes 1s to 10s to create
+	for i := 1; i <= 10; i++ {
+		rows := []string{
+			"Start Timestamp,End Timestamp,Stage,Action,Module,Resource Type,Resource Name,Resource Key,Status,Duration (sec)",
+			"0,0,refresh,refresh,,random_pet,dog,null,complete,1",
+			"0,0,apply,create,,random_pet,dog,null,complete," + strconv.Itoa(i),
+			// The errored and the aux operations are ignored
+			"0,0,apply,create,,random_pet,cat,null,error,100",
+			"0,0,aux,read,,random_pet,cat,null,complete,100",
+		}
+		require.NoError(t, h.Ingest([]byte(strings.Join(rows, "\n"))))
+	}
+	require.NoError(t, h.Save())
+
+	h, err = history.Load(dir, "/project")
+	require.NoError(t, err)
+
+	require.Equal(t, &state.ExpectedDuration{Median: 5 * time.Second, P90: 9 * time.Second}, h.Expected("apply", newInfo("random_pet", "dog", "create")))
+	require.Equal(t, &state.ExpectedDuration{Median: time.Second, P90: time.Second}, h.Expected("refresh", newInfo("random_pet", "dog", "refresh")))
+	// Falls back to the same resource type
+	require.Equal(t, &state.ExpectedDuration{Median: 5 * time.Second, P90: 9 * time.Second}, h.Expected("apply", newInfo("random_pet", "cat", "create")))
+	require.Nil(t, h.Expected("apply", newInfo("random_pet", "dog", "delete")))
+	require.Nil(t, h.Expected("apply", newInfo("null_resource", "dog", "create")))
+
+	// A nil history expects nothing
+	var nilHistory *history.History
+	require.Nil(t, nilHistory.Expected("apply", newInfo("random_pet", "dog", "create")))
+}
+
+func TestHistoryMaxSamples(t *testing.T) {
+	dir := t.TempDir()
+
+	h, err := history.Load(dir, "/project")
+	require.NoError(t, err)
+	for i := 1; i <= 30; i++ {
+		require.NoError(t, h.Ingest([]byte("0,0,apply,create,,random_pet,dog,null,complete,"+strconv.Itoa(i))))
+	}
+	require.NoError(t, h.Save())
+
+	b, err := os.ReadFile(historyFile(t, dir))
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+	// The header and the latest 20 samples
+	require.Len(t, lines, 21)
+	require.Equal(t, "0,0,apply,create,,random_pet,dog,null,complete,11", lines[1])
+}
+
+func TestHistoryQuoted(t *testing.T) {
+	dir := t.TempDir()
+
+	h, err := history.Load(dir, "/project")
+	require.NoError(t, err)
+	// The module key and the resource key contain commas and quotes
+	row := `0,0,apply,create,"module.m[""a,b""]",random_pet,dog,"""x,y""",complete,3`
+	require.NoError(t, h.Ingest([]byte(row)))
+	require.NoError(t, h.Save())
+
+	b, err := os.ReadFile(historyFile(t, dir))
+	require.NoError(t, err)
+	require.Equal(t, row, strings.Split(strings.TrimSpace(string(b)), "\n")[1])
+
+	h, err = history.Load(dir, "/project")
+	require.NoError(t, err)
+	info := newInfo("random_pet", "dog", "create")
+	info.Loc.Module = `module.m["a,b"]`
+	require.NoError(t, info.RawResourceAddr.ResourceKey.UnmarshalJSON([]byte(`"x,y"`)))
+	require.Equal(t, &state.ExpectedDuration{Median: 3 * time.Second, P90: 3 * time.Second}, h.Expected("apply", info))
+
+	// The malformed rows are reported rather than dropped
+	require.ErrorContains(t, h.Ingest([]byte("0,0,apply,create,module.m[a,b],random_pet,dog,null,complete,3")), "wrong number of fields")
+}
+
+func TestHistoryProjects(t *testing.T) {
+	dir := t.TempDir()
+
+	for project, sec := range map[string]string{"/a": "1", "/b": "9"} {
+		h, err := history.Load(dir, project)
+		require.NoError(t, err)
+		require.NoError(t, h.Ingest([]byte("0,0,apply,create,,random_pet,dog,null,complete,"+sec)))
+		require.NoError(t, h.Save())
+	}
+
+	// The same address of the different projects isn't mixed up
+	h, err := history.Load(dir, "/a")
+	require.NoError(t, err)
+	require.Equal(t, &state.ExpectedDuration{Median: time.Second, P90: time.Second}, h.Expected("apply", newInfo("random_pet", "dog", "create")))
+	h, err = history.Load(dir, "/c")
+	require.NoError(t, err)
+	require.Nil(t, h.Expected("apply", newInfo("random_pet", "dog", "create")))
+}
+
+func TestHistoryConcurrentSave(t *testing.T) {
+	dir := t.TempDir()
+
+	// Both runs load the history before either saves
+	var hs []*history.History
+	for i := 0; i < 2; i++ {
+		h, err := history.Load(dir, "/project")
+		require.NoError(t, err)
+		hs = append(hs, h)
+	}
+	for i, h := range hs {
+		require.NoError(t, h.Ingest([]byte("0,0,apply,create,,random_pet,dog,null,complete,"+strconv.Itoa(i+1))))
+		require.NoError(t, h.Save())
+	}
+
+	// Neither sample is dropped
+	h, err := history.Load(dir, "/project")
+	require.NoError(t, err)
+	require.Equal(t, &state.ExpectedDuration{Median: time.Second, P90: 2 * time.Second}, h.Expected("apply", newInfo("random_pet", "dog", "create")))
+
+	// Only the history file and its lock file are left
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+}
+
+func TestDefaultDir(t *testing.T) {
+	t.Setenv("XDG_DATA_HOME", "/data")
+	dir, err := history.DefaultDir()
+	require.NoError(t, err)
+	require.Equal(t, filepath.Join("/data", "pipeform"), dir)
+}
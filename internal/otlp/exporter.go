@@ -0,0 +1,345 @@
+package otlp
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	gojson "encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultEndpoint    = "http://localhost:4318"
+	tracesPath         = "/v1/traces"
+	defaultTimeout     = 10 * time.Second
+	defaultServiceName = "pipeform"
+
+	protocolJSON    = "http/json"
+	compressionGzip = "gzip"
+	compressionNone = "none"
+
+	// spanKindInternal is the kind of all the spans, as none of them is a remote call
+	spanKindInternal = 1
+	statusCodeError  = 2
+)
+
+// Config is the config of the exporter, which is read from the standard OTEL_* environment variables.
+type Config struct {
+	// Endpoint is the full URL to post the spans to
+	Endpoint string
+	Headers  map[string]string
+	Timeout  time.Duration
+	// Gzip tells whether to compress the request body with gzip
+	Gzip bool
+	// Resource are the attributes of the resource, e.g. the service.name
+	Resource []Attribute
+}
+
+// ConfigFromEnv reads the config from the OTEL_EXPORTER_OTLP_* environment variables, where the trace specific
+// ones (e.g. OTEL_EXPORTER_OTLP_TRACES_ENDPOINT) take precedence. The resource is read from OTEL_SERVICE_NAME and
+// OTEL_RESOURCE_ATTRIBUTES. Only the http/json protocol is supported.
+// Reference: https://opentelemetry.io/docs/specs/otel/protocol/exporter/
+func ConfigFromEnv(getenv func(string) string) (Config, error) {
+	lookup := func(name string) string {
+		if v := getenv("OTEL_EXPORTER_OTLP_TRACES_" + name); v != "" {
+			return v
+		}
+		return getenv("OTEL_EXPORTER_OTLP_" + name)
+	}
+
+	cfg := Config{
+		Endpoint: defaultEndpoint + tracesPath,
+		Timeout:  defaultTimeout,
+	}
+
+	// The signal specific endpoint is used as is, while the path is appended to the base one.
+	if v := getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT"); v != "" {
+		cfg.Endpoint = v
+	} else if v := getenv("OTEL_EXPORTER_OTLP_ENDPOINT"); v != "" {
+		cfg.Endpoint = strings.TrimSuffix(v, "/") + tracesPath
+	}
+	if _, err := url.ParseRequestURI(cfg.Endpoint); err != nil {
+		return Config{}, fmt.Errorf("invalid OTLP endpoint %q: %v", cfg.Endpoint, err)
+	}
+
+	if v := lookup("PROTOCOL"); v != "" && v != protocolJSON {
+		return Config{}, fmt.Errorf("unsupported OTLP protocol %q, only %q is supported", v, protocolJSON)
+	}
+
+	headers, err := parseKeyValues(lookup("HEADERS"))
+	if err != nil {
+		return Config{}, fmt.Errorf("invalid OTLP headers: %v", err)
+	}
+	for _, kv := range headers {
+		if cfg.Headers == nil {
+			cfg.Headers = map[string]string{}
+		}
+		cfg.Headers[kv.Key] = kv.Value.(string)
+	}
+
+	if v := lookup("TIMEOUT"); v != "" {
+		ms, err := strconv.Atoi(v)
+		if err != nil || ms <= 0 {
+			return Config{}, fmt.Errorf("invalid OTLP timeout %q, expect a positive number of milliseconds", v)
+		}
+		cfg.Timeout = time.Duration(ms) * time.Millisecond
+	}
+
+	switch v := lookup("COMPRESSION"); v {
+	case "", compressionNone:
+	case compressionGzip:
+		cfg.Gzip = true
+	default:
+		return Config{}, fmt.Errorf("unsupported OTLP compression %q", v)
+	}
+
+	cfg.Resource, err = parseKeyValues(getenv("OTEL_RESOURCE_ATTRIBUTES"))
+	if err != nil {
+		return Config{}, fmt.Errorf("invalid OTEL_RESOURCE_ATTRIBUTES: %v", err)
+	}
+	// The OTEL_SERVICE_NAME takes precedence over the service.name in the OTEL_RESOURCE_ATTRIBUTES.
+	serviceName := getenv("OTEL_SERVICE_NAME")
+	idx := slices.IndexFunc(cfg.Resource, func(attr Attribute) bool { return attr.Key == "service.name" })
+	switch {
+	case idx == -1:
+		if serviceName == "" {
+			serviceName = defaultServiceName
+		}
+		cfg.Resource = append([]Attribute{{"service.name", serviceName}}, cfg.Resource...)
+	case serviceName != "":
+		cfg.Resource[idx].Value = serviceName
+	}
+	return cfg, nil
+}
+
+// parseKeyValues parses the comma separated list of key=value pairs, whose values are percent encoded (a "+" is kept
+// as is, rather than decoded as a space).
+func parseKeyValues(s string) ([]Attribute, error) {
+	var out []Attribute
+	for _, pair := range strings.Split(s, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		k, v, ok := strings.Cut(pair, "=")
+		if !ok {
+			return nil, fmt.Errorf("missing %q in %q", "=", pair)
+		}
+		value, err := url.PathUnescape(strings.TrimSpace(v))
+		if err != nil {
+			return nil, fmt.Errorf("decoding the value of %q: %v", k, err)
+		}
+		out = append(out, Attribute{Key: strings.TrimSpace(k), Value: value})
+	}
+	return out, nil
+}
+
+// Export posts the spans under the root span to the collector, in a new trace.
+func Export(ctx context.Context, cfg Config, root *Span) error {
+	b, err := payload(cfg.Resource, root)
+	if err != nil {
+		return err
+	}
+
+	encoding := ""
+	if cfg.Gzip {
+		var buf bytes.Buffer
+		w := gzip.NewWriter(&buf)
+		if _, err := w.Write(b); err != nil {
+			return fmt.Errorf("compressing spans: %v", err)
+		}
+		if err := w.Close(); err != nil {
+			return fmt.Errorf("compressing spans: %v", err)
+		}
+		b = buf.Bytes()
+		encoding = compressionGzip
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, cfg.Timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, cfg.Endpoint, bytes.NewReader(b))
+	if err != nil {
+		return fmt.Errorf("new request: %v", err)
+	}
+	for k, v := range cfg.Headers {
+		req.Header.Set(k, v)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if encoding != "" {
+		req.Header.Set("Content-Encoding", encoding)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("posting spans: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("posting spans: %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+// The types below are the JSON encoding of the ExportTraceServiceRequest, which only contain the used fields.
+// Reference: https://github.com/open-telemetry/opentelemetry-proto/blob/main/opentelemetry/proto/trace/v1/trace.proto
+
+type exportRequest struct {
+	ResourceSpans []resourceSpans `json:"resourceSpans"`
+}
+
+type resourceSpans struct {
+	Resource   resource     `json:"resource"`
+	ScopeSpans []scopeSpans `json:"scopeSpans"`
+}
+
+type resource struct {
+	Attributes []keyValue `json:"attributes"`
+}
+
+type scopeSpans struct {
+	Scope scope  `json:"scope"`
+	Spans []span `json:"spans"`
+}
+
+type scope struct {
+	Name string `json:"name"`
+}
+
+type span struct {
+	TraceID           string     `json:"traceId"`
+	SpanID            string     `json:"spanId"`
+	ParentSpanID      string     `json:"parentSpanId,omitempty"`
+	Name              string     `json:"name"`
+	Kind              int        `json:"kind"`
+	StartTimeUnixNano string     `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string     `json:"endTimeUnixNano"`
+	Attributes        []keyValue `json:"attributes,omitempty"`
+	Events            []event    `json:"events,omitempty"`
+	Status            status     `json:"status"`
+}
+
+type event struct {
+	TimeUnixNano string     `json:"timeUnixNano"`
+	Name         string     `json:"name"`
+	Attributes   []keyValue `json:"attributes,omitempty"`
+}
+
+type status struct {
+	Code    int    `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+type keyValue struct {
+	Key   string   `json:"key"`
+	Value anyValue `json:"value"`
+}
+
+type anyValue struct {
+	StringValue *string `json:"stringValue,omitempty"`
+	// IntValue is a string, as the int64 is encoded as a decimal string in the JSON encoding
+	IntValue  *string `json:"intValue,omitempty"`
+	BoolValue *bool   `json:"boolValue,omitempty"`
+}
+
+// payload renders the spans in the JSON encoding, with the random trace id and span ids.
+func payload(res []Attribute, root *Span) ([]byte, error) {
+	traceID, err := randomID(16)
+	if err != nil {
+		return nil, err
+	}
+	var spans []span
+	var walk func(s *Span, parentID string) error
+	walk = func(s *Span, parentID string) error {
+		spanID, err := randomID(8)
+		if err != nil {
+			return err
+		}
+		out := span{
+			TraceID:           traceID,
+			SpanID:            spanID,
+			ParentSpanID:      parentID,
+			Name:              s.Name,
+			Kind:              spanKindInternal,
+			StartTimeUnixNano: unixNano(s.Start),
+			EndTimeUnixNano:   unixNano(s.End),
+			Attributes:        keyValues(s.Attributes),
+		}
+		if s.Error {
+			out.Status = status{Code: statusCodeError, Message: s.ErrorMessage}
+		}
+		for _, e := range s.Events {
+			out.Events = append(out.Events, event{
+				TimeUnixNano: unixNano(e.Time),
+				Name:         e.Name,
+				Attributes:   keyValues(e.Attributes),
+			})
+		}
+		spans = append(spans, out)
+		for _, child := range s.Children {
+			if err := walk(child, spanID); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := walk(root, ""); err != nil {
+		return nil, err
+	}
+
+	req := exportRequest{
+		ResourceSpans: []resourceSpans{{
+			Resource: resource{Attributes: keyValues(res)},
+			ScopeSpans: []scopeSpans{{
+				Scope: scope{Name: "github.com/magodo/pipeform"},
+				Spans: spans,
+			}},
+		}},
+	}
+	b, err := gojson.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("marshal spans: %v", err)
+	}
+	return b, nil
+}
+
+func keyValues(attrs []Attribute) []keyValue {
+	var out []keyValue
+	for _, attr := range attrs {
+		var v anyValue
+		switch value := attr.Value.(type) {
+		case string:
+			v.StringValue = &value
+		case int:
+			s := strconv.Itoa(value)
+			v.IntValue = &s
+		case bool:
+			v.BoolValue = &value
+		default:
+			s := fmt.Sprint(value)
+			v.StringValue = &s
+		}
+		out = append(out, keyValue{Key: attr.Key, Value: v})
+	}
+	return out
+}
+
+func unixNano(t time.Time) string {
+	return strconv.FormatInt(t.UnixNano(), 10)
+}
+
+func randomID(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("generating id: %v", err)
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,213 @@
+// Package otlp exports the run as OpenTelemetry spans via OTLP/HTTP, in the JSON encoding.
+//
+// The run is the root span, whose children are the phases (e.g. refresh, plan and apply), which in turn are the
+// parents of the resource operations that start during them.
+// Reference: https://opentelemetry.io/docs/specs/otlp/
+package otlp
+
+import (
+	"strings"
+	"time"
+
+	"github.com/magodo/pipeform/internal/engine"
+	"github.com/magodo/pipeform/internal/state"
+	"github.com/magodo/pipeform/terraform/views/json"
+)
+
+// Span is a span before being exported, whose ids are only assigned on export.
+type Span struct {
+	Name       string
+	Start      time.Time
+	End        time.Time
+	Attributes []Attribute
+	// Error tells whether the span is errored, with the message
+	Error        bool
+	ErrorMessage string
+	Events       []Event
+	Children     []*Span
+}
+
+// Attribute is a span attribute, whose value is either a string, an int or a bool.
+type Attribute struct {
+	Key   string
+	Value any
+}
+
+// Event is a timed event of a span, e.g. a diagnostic.
+type Event struct {
+	Name       string
+	Time       time.Time
+	Attributes []Attribute
+}
+
+// Spans returns the spans of the run recorded by the engine, as a tree under the root span. The now is used as
+// the end of the in-progress phases and operations.
+func Spans(e *engine.Engine, now time.Time) *Span {
+	name := "terraform"
+	if op := e.Operation(); op != "" {
+		name += " " + string(op)
+	}
+	root := &Span{
+		Name:  name,
+		Start: e.StartTime(),
+		End:   now,
+	}
+	if v := e.Version(); v != "" {
+		root.Attributes = append(root.Attributes, Attribute{"terraform.version", v})
+	}
+	if op := e.Operation(); op != "" {
+		root.Attributes = append(root.Attributes, Attribute{"terraform.operation", string(op)})
+	}
+	if cs := e.ChangeSummary(); cs != nil {
+		root.Attributes = append(root.Attributes,
+			Attribute{"terraform.changes.add", cs.Add},
+			Attribute{"terraform.changes.change", cs.Change},
+			Attribute{"terraform.changes.import", cs.Import},
+			Attribute{"terraform.changes.remove", cs.Remove},
+		)
+	}
+	warnings, errors := e.Diags().Count()
+	root.Attributes = append(root.Attributes,
+		Attribute{"terraform.diagnostics.warnings", warnings},
+		Attribute{"terraform.diagnostics.errors", errors},
+	)
+	if errors != 0 {
+		root.Error = true
+		root.ErrorMessage = "the run has error diagnostics"
+	}
+
+	phases := phaseSpans(e, now)
+	root.Children = append(root.Children, phases...)
+
+	// The operation spans are the children of the phase they start in, or the root span if there is none.
+	parentOf := func(start time.Time) *Span {
+		for i := len(phases) - 1; i >= 0; i-- {
+			if !start.Before(phases[i].Start) {
+				return phases[i]
+			}
+		}
+		return root
+	}
+	linked := map[json.Diagnostic]bool{}
+	for _, infos := range []state.ResourceOperationInfos{e.RefreshInfos(), e.AuxInfos(), e.ApplyInfos()} {
+		for _, info := range infos.All() {
+			if info.StartTime.IsZero() {
+				continue
+			}
+			for _, d := range info.Diags {
+				linked[d] = true
+			}
+			parent := parentOf(info.StartTime)
+			parent.Children = append(parent.Children, operationSpan(info, now))
+		}
+	}
+
+	// The diagnostics that aren't linked to any operation are the events of the root span.
+	for _, d := range e.Diags() {
+		if !linked[d] {
+			root.Events = append(root.Events, diagEvent(d, root.End))
+		}
+	}
+	return root
+}
+
+// phaseSpans returns the spans of the visited phases, except the idle and the summary ones, which have no
+// operation. Each phase ends when the next one starts.
+func phaseSpans(e *engine.Engine, now time.Time) []*Span {
+	visited := e.VisitedPhases()
+	starts := e.PhaseStartTimes()
+
+	var spans []*Span
+	for i, phase := range visited {
+		if phase == engine.PhaseIdle || phase == engine.PhaseSummary {
+			continue
+		}
+		end := now
+		if i+1 < len(visited) {
+			end = starts[i+1]
+		}
+		spans = append(spans, &Span{
+			Name:       strings.ToLower(phase.String()),
+			Start:      starts[i],
+			End:        end,
+			Attributes: []Attribute{{"terraform.phase", strings.ToLower(phase.String())}},
+		})
+	}
+	return spans
+}
+
+func operationSpan(info *state.ResourceOperationInfo, now time.Time) *Span {
+	addr := info.RawResourceAddr
+	end := info.EndTime
+	if end.IsZero() {
+		end = now
+	}
+	span := &Span{
+		Name:  info.Loc.Action + " " + info.Loc.ResourceAddr,
+		Start: info.StartTime,
+		End:   end,
+		Attributes: []Attribute{
+			{"terraform.resource.address", info.Loc.ResourceAddr},
+			{"terraform.resource.module", addr.Module},
+			{"terraform.resource.type", addr.ResourceType},
+			{"terraform.resource.name", addr.ResourceName},
+			{"terraform.resource.provider", addr.ImpliedProvider},
+			{"terraform.action", info.Loc.Action},
+			{"terraform.status", string(info.Status)},
+		},
+	}
+	if key, _ := addr.ResourceKey.MarshalJSON(); len(key) != 0 && string(key) != "null" {
+		span.Attributes = append(span.Attributes, Attribute{"terraform.resource.key", string(key)})
+	}
+	if info.IDValue != "" {
+		span.Attributes = append(span.Attributes,
+			Attribute{"terraform.resource.id_key", info.IDKey},
+			Attribute{"terraform.resource.id_value", info.IDValue},
+		)
+	}
+
+	if info.Status == state.ResourceOperationStatusErrored {
+		span.Error = true
+		span.ErrorMessage = "the operation errored"
+		for _, d := range info.Diags {
+			if d.Severity == json.DiagnosticSeverityError {
+				span.ErrorMessage = d.Summary
+				break
+			}
+		}
+	}
+	for _, d := range info.Diags {
+		span.Events = append(span.Events, diagEvent(d, end))
+	}
+
+	for _, p := range info.Provisioners {
+		pend := p.EndTime
+		if pend.IsZero() {
+			pend = now
+		}
+		span.Children = append(span.Children, &Span{
+			Name:       "provision " + p.Provisioner,
+			Start:      p.StartTime,
+			End:        pend,
+			Attributes: []Attribute{{"terraform.provisioner", p.Provisioner}, {"terraform.status", string(p.Status)}},
+			Error:      p.Status == state.ResourceOperationStatusErrored,
+		})
+	}
+	return span
+}
+
+// diagEvent returns the event of the diagnostic. The diagnostics don't have the timestamps, so the time of the
+// event is decided by the caller, e.g. the end of the operation it links to.
+func diagEvent(d json.Diagnostic, t time.Time) Event {
+	attrs := []Attribute{
+		{"diagnostic.severity", string(d.Severity)},
+		{"diagnostic.summary", d.Summary},
+	}
+	if d.Detail != "" {
+		attrs = append(attrs, Attribute{"diagnostic.detail", d.Detail})
+	}
+	if d.Address != "" {
+		attrs = append(attrs, Attribute{"diagnostic.address", d.Address})
+	}
+	return Event{Name: string(d.Severity), Time: t, Attributes: attrs}
+}
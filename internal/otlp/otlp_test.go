@@ -0,0 +1,316 @@
+package otlp_test
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/magodo/pipeform/internal/engine"
+	"github.com/magodo/pipeform/internal/enginetest"
+	"github.com/magodo/pipeform/internal/otlp"
+	"github.com/stretchr/testify/require"
+)
+
+var now = time.Date(2025, 1, 10, 10, 0, 20, 0, time.UTC)
+
+// recordedEngine returns the engine that has applied the recorded stream.
+func recordedEngine(t *testing.T, name string) *engine.Engine {
+	e, _ := enginetest.Apply(t, name)
+	return e
+}
+
+func attr(s *otlp.Span, key string) any {
+	for _, a := range s.Attributes {
+		if a.Key == key {
+			return a.Value
+		}
+	}
+	return nil
+}
+
+func TestSpans(t *testing.T) {
+	root := otlp.Spans(recordedEngine(t, "apply.jsonl"), now)
+
+	require.Equal(t, "terraform apply", root.Name)
+	require.Equal(t, "2025-01-10T10:00:01Z", root.Start.Format(time.RFC3339))
+	require.Equal(t, now, root.End)
+	require.Equal(t, "Terraform 1.10.3", attr(root, "terraform.version"))
+	require.Equal(t, 3, attr(root, "terraform.changes.add"))
+	require.Equal(t, 1, attr(root, "terraform.diagnostics.errors"))
+	require.True(t, root.Error)
+
+	// The phases, each ends when the next one starts
+	var phases []string
+	for _, p := range root.Children {
+		phases = append(phases, p.Name)
+	}
+	require.Equal(t, []string{"refresh", "plan", "apply"}, phases)
+	refresh, plan, apply := root.Children[0], root.Children[1], root.Children[2]
+	require.Equal(t, plan.Start, refresh.End)
+	require.Equal(t, apply.Start, plan.End)
+	require.Empty(t, plan.Children)
+
+	require.Len(t, refresh.Children, 1)
+	dog := refresh.Children[0]
+	require.Equal(t, "refresh random_pet.dog", dog.Name)
+	require.Equal(t, []otlp.Attribute{
+		{Key: "terraform.resource.address", Value: "random_pet.dog"},
+		{Key: "terraform.resource.module", Value: ""},
+		{Key: "terraform.resource.type", Value: "random_pet"},
+		{Key: "terraform.resource.name", Value: "dog"},
+		{Key: "terraform.resource.provider", Value: "random"},
+		{Key: "terraform.action", Value: "refresh"},
+		{Key: "terraform.status", Value: "complete"},
+		{Key: "terraform.resource.id_key", Value: "id"},
+		{Key: "terraform.resource.id_value", Value: "smart-lizard"},
+	}, dog.Attributes)
+	require.False(t, dog.Error)
+
+	var ops []string
+	for _, op := range apply.Children {
+		ops = append(ops, op.Name)
+	}
+	require.Equal(t, []string{"delete random_pet.dog", "create random_pet.cat", "create module.m.null_resource.bad", "create random_pet.dog"}, ops)
+
+	// The id of the created resource is known at the end
+	require.Equal(t, "good-dog", attr(apply.Children[3], "terraform.resource.id_value"))
+
+	// The errored operation has the error status, with the linked diagnostic as its event
+	bad := apply.Children[2]
+	require.Equal(t, "module.m", attr(bad, "terraform.resource.module"))
+	require.True(t, bad.Error)
+	require.Equal(t, "local-exec provisioner error", bad.ErrorMessage)
+	require.Len(t, bad.Events, 1)
+	require.Equal(t, "error", bad.Events[0].Name)
+	require.Equal(t, bad.End, bad.Events[0].Time)
+	require.Empty(t, root.Events)
+}
+
+func TestSpansInProgress(t *testing.T) {
+	root := otlp.Spans(recordedEngine(t, "provision.jsonl"), now)
+
+	apply := root.Children[len(root.Children)-1]
+	require.Equal(t, "apply", apply.Name)
+	for _, op := range apply.Children {
+		require.Len(t, op.Children, 1)
+		require.Equal(t, "provision local-exec", op.Children[0].Name)
+	}
+}
+
+func TestConfigFromEnv(t *testing.T) {
+	cases := []struct {
+		name   string
+		env    map[string]string
+		expect otlp.Config
+		err    string
+	}{
+		{
+			name: "default",
+			expect: otlp.Config{
+				Endpoint: "http://localhost:4318/v1/traces",
+				Timeout:  10 * time.Second,
+				Resource: []otlp.Attribute{{Key: "service.name", Value: "pipeform"}},
+			},
+		},
+		{
+			name: "base endpoint",
+			env: map[string]string{
+				"OTEL_EXPORTER_OTLP_ENDPOINT":    "https://collector:4318/",
+				"OTEL_EXPORTER_OTLP_HEADERS":     "x-api-key=secret,authorization=Bearer%20token",
+				"OTEL_EXPORTER_OTLP_TIMEOUT":     "500",
+				"OTEL_EXPORTER_OTLP_COMPRESSION": "gzip",
+				"OTEL_EXPORTER_OTLP_PROTOCOL":    "http/json",
+				"OTEL_RESOURCE_ATTRIBUTES":       "service.name=ci,deployment.environment=prod",
+			},
+			expect: otlp.Config{
+				Endpoint: "https://collector:4318/v1/traces",
+				Headers:  map[string]string{"x-api-key": "secret", "authorization": "Bearer token"},
+				Timeout:  500 * time.Millisecond,
+				Gzip:     true,
+				Resource: []otlp.Attribute{{Key: "service.name", Value: "ci"}, {Key: "deployment.environment", Value: "prod"}},
+			},
+		},
+		{
+			name: "plus sign",
+			env: map[string]string{
+				"OTEL_EXPORTER_OTLP_HEADERS": "authorization=Basic%20dXNlcjpw+c3M=",
+				"OTEL_RESOURCE_ATTRIBUTES":   "service.version=1.0+build",
+			},
+			expect: otlp.Config{
+				Endpoint: "http://localhost:4318/v1/traces",
+				Headers:  map[string]string{"authorization": "Basic dXNlcjpw+c3M="},
+				Timeout:  10 * time.Second,
+				Resource: []otlp.Attribute{{Key: "service.name", Value: "pipeform"}, {Key: "service.version", Value: "1.0+build"}},
+			},
+		},
+		{
+			name: "traces specific",
+			env: map[string]string{
+				"OTEL_EXPORTER_OTLP_ENDPOINT":        "https://collector:4318",
+				"OTEL_EXPORTER_OTLP_TRACES_ENDPOINT": "https://traces:4318/custom",
+				"OTEL_EXPORTER_OTLP_TIMEOUT":         "500",
+				"OTEL_EXPORTER_OTLP_TRACES_TIMEOUT":  "1000",
+				"OTEL_SERVICE_NAME":                  "terraform",
+				"OTEL_RESOURCE_ATTRIBUTES":           "service.name=ci",
+			},
+			expect: otlp.Config{
+				Endpoint: "https://traces:4318/custom",
+				Timeout:  time.Second,
+				Resource: []otlp.Attribute{{Key: "service.name", Value: "terraform"}},
+			},
+		},
+		{
+			name: "unsupported protocol",
+			env:  map[string]string{"OTEL_EXPORTER_OTLP_PROTOCOL": "grpc"},
+			err:  `unsupported OTLP protocol "grpc"`,
+		},
+		{
+			name: "invalid timeout",
+			env:  map[string]string{"OTEL_EXPORTER_OTLP_TRACES_TIMEOUT": "10s"},
+			err:  `invalid OTLP timeout "10s"`,
+		},
+		{
+			name: "invalid headers",
+			env:  map[string]string{"OTEL_EXPORTER_OTLP_HEADERS": "x-api-key"},
+			err:  "invalid OTLP headers",
+		},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := otlp.ConfigFromEnv(func(k string) string { return tt.env[k] })
+			if tt.err != "" {
+				require.ErrorContains(t, err, tt.err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.expect, cfg)
+		})
+	}
+}
+
+// The JSON encoding of the exported spans, which only contains the checked fields
+type exportRequest struct {
+	ResourceSpans []struct {
+		Resource struct {
+			Attributes []keyValue `json:"attributes"`
+		} `json:"resource"`
+		ScopeSpans []struct {
+			Spans []span `json:"spans"`
+		} `json:"scopeSpans"`
+	} `json:"resourceSpans"`
+}
+
+type span struct {
+	TraceID           string     `json:"traceId"`
+	SpanID            string     `json:"spanId"`
+	ParentSpanID      string     `json:"parentSpanId"`
+	Name              string     `json:"name"`
+	StartTimeUnixNano string     `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string     `json:"endTimeUnixNano"`
+	Attributes        []keyValue `json:"attributes"`
+	Events            []struct {
+		Name string `json:"name"`
+	} `json:"events"`
+	Status struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"status"`
+}
+
+type keyValue struct {
+	Key   string         `json:"key"`
+	Value map[string]any `json:"value"`
+}
+
+func TestExport(t *testing.T) {
+	var (
+		header http.Header
+		path   string
+		req    exportRequest
+	)
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header
+		path = r.URL.Path
+		zr, err := gzip.NewReader(r.Body)
+		require.NoError(t, err)
+		require.NoError(t, json.NewDecoder(zr).Decode(&req))
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte("{}"))
+	}))
+	defer collector.Close()
+
+	env := map[string]string{
+		"OTEL_EXPORTER_OTLP_ENDPOINT":    collector.URL,
+		"OTEL_EXPORTER_OTLP_HEADERS":     "authorization=Bearer%20token",
+		"OTEL_EXPORTER_OTLP_COMPRESSION": "gzip",
+	}
+	cfg, err := otlp.ConfigFromEnv(func(k string) string { return env[k] })
+	require.NoError(t, err)
+
+	root := otlp.Spans(recordedEngine(t, "apply.jsonl"), now)
+	require.NoError(t, otlp.Export(context.Background(), cfg, root))
+
+	require.Equal(t, "/v1/traces", path)
+	require.Equal(t, "application/json", header.Get("Content-Type"))
+	require.Equal(t, "gzip", header.Get("Content-Encoding"))
+	require.Equal(t, "Bearer token", header.Get("Authorization"))
+
+	require.Len(t, req.ResourceSpans, 1)
+	require.Equal(t, []keyValue{{Key: "service.name", Value: map[string]any{"stringValue": "pipeform"}}}, req.ResourceSpans[0].Resource.Attributes)
+	require.Len(t, req.ResourceSpans[0].ScopeSpans, 1)
+	spans := req.ResourceSpans[0].ScopeSpans[0].Spans
+
+	// The root, 3 phases and 5 operations
+	require.Len(t, spans, 9)
+	byID := map[string]span{}
+	byName := map[string]span{}
+	for _, s := range spans {
+		require.Equal(t, spans[0].TraceID, s.TraceID)
+		require.Len(t, s.TraceID, 32)
+		require.Len(t, s.SpanID, 16)
+		byID[s.SpanID] = s
+		byName[s.Name] = s
+	}
+	require.Empty(t, spans[0].ParentSpanID)
+	require.Equal(t, "terraform apply", spans[0].Name)
+	require.Equal(t, "1736503201000000000", spans[0].StartTimeUnixNano)
+	require.Equal(t, "1736503220000000000", spans[0].EndTimeUnixNano)
+	require.Contains(t, spans[0].Attributes, keyValue{Key: "terraform.changes.add", Value: map[string]any{"intValue": "3"}})
+
+	// The operations are the children of the phases
+	bad := byName["create module.m.null_resource.bad"]
+	require.Equal(t, "apply", byID[bad.ParentSpanID].Name)
+	require.Equal(t, spans[0].SpanID, byID[bad.ParentSpanID].ParentSpanID)
+	require.Equal(t, 2, bad.Status.Code)
+	require.Equal(t, "local-exec provisioner error", bad.Status.Message)
+	require.Len(t, bad.Events, 1)
+	require.Contains(t, bad.Attributes, keyValue{Key: "terraform.resource.type", Value: map[string]any{"stringValue": "null_resource"}})
+
+	dog := byName["refresh random_pet.dog"]
+	require.Equal(t, "refresh", byID[dog.ParentSpanID].Name)
+	require.Zero(t, dog.Status.Code)
+	require.Contains(t, dog.Attributes, keyValue{Key: "terraform.resource.id_value", Value: map[string]any{"stringValue": "smart-lizard"}})
+}
+
+func TestExportError(t *testing.T) {
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "quota exceeded", http.StatusTooManyRequests)
+	}))
+	defer collector.Close()
+
+	cfg, err := otlp.ConfigFromEnv(func(k string) string {
+		if k == "OTEL_EXPORTER_OTLP_TRACES_ENDPOINT" {
+			return collector.URL + "/v1/traces"
+		}
+		return ""
+	})
+	require.NoError(t, err)
+
+	err = otlp.Export(context.Background(), cfg, otlp.Spans(recordedEngine(t, "apply.jsonl"), now))
+	require.ErrorContains(t, err, "429 Too Many Requests: quota exceeded")
+}
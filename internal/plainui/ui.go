@@ -6,55 +6,155 @@ import (
 	"strings"
 	"time"
 
+	"github.com/magodo/pipeform/internal/clock"
+	"github.com/magodo/pipeform/internal/concurrency"
 	"github.com/magodo/pipeform/internal/csv"
+	"github.com/magodo/pipeform/internal/diag"
+	"github.com/magodo/pipeform/internal/engine"
+	"github.com/magodo/pipeform/internal/estimate"
+	"github.com/magodo/pipeform/internal/history"
 	"github.com/magodo/pipeform/internal/log"
+	"github.com/magodo/pipeform/internal/otlp"
 	"github.com/magodo/pipeform/internal/reader"
+	"github.com/magodo/pipeform/internal/report"
 	"github.com/magodo/pipeform/internal/state"
-	"github.com/magodo/pipeform/internal/terraform/views"
-	"github.com/magodo/pipeform/internal/terraform/views/json"
+	"github.com/magodo/pipeform/internal/trace"
+	"github.com/magodo/pipeform/terraform/views"
+	"github.com/magodo/pipeform/terraform/views/json"
 )
 
 type UIModel struct {
-	startTime time.Time
-	logger    *log.Logger
-	reader    reader.Reader
-	writer    io.Writer
+	logger *log.Logger
+	reader reader.MessageReader
+	writer io.Writer
+	clock  clock.Clock
 
-	refreshInfos state.ResourceOperationInfos
-	applyInfos   state.ResourceOperationInfos
+	engine *engine.Engine
 
-	totalCnt int
-	doneCnt  int
+	// statusInterval is the interval of printing the status line during the refresh and the apply, 0 means never.
+	statusInterval time.Duration
+
+	// parallelism is the -parallelism of Terraform, against which the concurrency is analyzed
+	parallelism int
+
+	// history is only used to create the engine
+	history *history.History
 
 	isEOF bool
+	// eofTime is when the stream reaches EOF, which is the end of the run for the exports
+	eofTime time.Time
+}
+
+type Option func(*UIModel)
+
+// WithClock sets the clock used to calculate the durations, which defaults to the wall clock.
+func WithClock(clock clock.Clock) Option {
+	return func(m *UIModel) {
+		m.clock = clock
+	}
 }
 
-func NewRuntimeModel(logger *log.Logger, reader reader.Reader, writer io.Writer, startTime time.Time) UIModel {
+// WithStatusInterval periodically prints a status line with the progress and the estimation during the refresh and
+// the apply.
+func WithStatusInterval(interval time.Duration) Option {
+	return func(m *UIModel) {
+		m.statusInterval = interval
+	}
+}
+
+// WithParallelism sets the -parallelism of Terraform, which defaults to concurrency.DefaultParallelism.
+func WithParallelism(n int) Option {
+	return func(m *UIModel) {
+		m.parallelism = n
+	}
+}
+
+// WithHistory prints the expected durations of the operations from the history, and warns the overdue ones.
+func WithHistory(h *history.History) Option {
+	return func(m *UIModel) {
+		m.history = h
+	}
+}
+
+func NewRuntimeModel(logger *log.Logger, reader reader.MessageReader, writer io.Writer, startTime time.Time, opts ...Option) UIModel {
 	model := UIModel{
-		startTime: startTime,
-		logger:    logger,
-		reader:    reader,
-		writer:    writer,
+		logger: logger,
+		reader: reader,
+		writer: writer,
+		clock:  clock.Real(),
+
+		parallelism: concurrency.DefaultParallelism,
 	}
 
+	for _, opt := range opts {
+		opt(&model)
+	}
+
+	model.engine = engine.New(logger, startTime, engine.WithHistory(model.history))
+
 	return model
 }
 
+type readResult struct {
+	msg views.Message
+	err error
+}
+
 func (m *UIModel) Run() error {
+	// The messages are read in a separate goroutine, so that the status line is printed even if there is no message
+	// for a while (e.g. creating a database).
+	ch := make(chan readResult)
+	go func() {
+		for {
+			msg, err := m.reader.Next()
+			ch <- readResult{msg: msg, err: err}
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	var tick <-chan time.Time
+	if m.statusInterval > 0 {
+		ticker := time.NewTicker(m.statusInterval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
 	for {
-		msg, err := m.reader.Next()
+		var res readResult
+		select {
+		case <-tick:
+			if status := m.status(); status != "" {
+				m.writer.Write([]byte(status + "\n"))
+			}
+			continue
+		case res = <-ch:
+		}
+
+		msg, err := res.msg, res.err
 		if err != nil {
 			if err == io.EOF {
 				m.isEOF = true
+				m.eofTime = m.clock.Now()
+				m.writeDriftSummary()
+				m.writeConcurrencySummary()
 				return nil
 			}
 			return err
 		}
 
+		events := m.engine.Apply(msg)
+
 		var msgstr string
 		switch msg := msg.(type) {
 		case views.VersionMsg:
 			msgstr = msg.Message
+			for _, ev := range events {
+				if ev, ok := ev.(engine.UnsupportedVersionEvent); ok {
+					msgstr += "\n" + diag.Render(ev.Diag)
+				}
+			}
 		case views.LogMsg:
 			kvs := []string{}
 			for k, v := range msg.KVs {
@@ -62,42 +162,13 @@ func (m *UIModel) Run() error {
 			}
 			msgstr = fmt.Sprintf("%s. %s", msg.Message, strings.Join(kvs, " "))
 		case views.DiagnosticsMsg:
-			msgstr = fmt.Sprintf("Summary: %s.", msg.Diagnostic.Summary)
-			if msg.Diagnostic.Detail != "" {
-				msgstr += fmt.Sprintf(" Detail: %s", msg.Diagnostic.Detail)
-			}
-			if msg.Level != "info" {
-				msgstr = fmt.Sprintf("[%s] %s", strings.ToUpper(msg.Level), msgstr)
-			}
+			msgstr = diag.Render(*msg.Diagnostic)
 		case views.ResourceDriftMsg:
 			msgstr = msg.Message
 		case views.PlannedChangeMsg:
-			// Normally, we don't need to handle the PlannedChangeMsg here, as the ChangeSummaryMsg has all these information.
-			// The exception is that when apply with a plan file, there is no ChangeSummaryMsg sent from Terraform at this moment.
-			// (see: https://github.com/magodo/pipeform/issues/1)
-			// The counting here is a fallback logic to cover the case above. Otherwise, it will just be overwritten by ChangeSummaryMsg.
-			//
-			// TODO: Once https://github.com/hashicorp/terraform/pull/36245 merged, remove this part.
-			//
-			// Referencing the logic of terraform: internal/command/views/operation.go
-			// But we also count the "import"
-			switch msg.Change.Action {
-			case json.ActionCreate:
-				m.totalCnt++
-			case json.ActionDelete:
-				m.totalCnt++
-			case json.ActionUpdate:
-				m.totalCnt++
-			case json.ActionReplace:
-				m.totalCnt += 2
-			case json.ActionImport:
-				m.totalCnt++
-			}
 			msgstr = msg.Message
 
 		case views.ChangeSummaryMsg:
-			changes := msg.Changes
-			m.totalCnt = changes.Add + changes.Change + changes.Import + changes.Remove
 			msgstr = msg.Message
 
 		case views.OutputMsg:
@@ -115,137 +186,156 @@ func (m *UIModel) Run() error {
 			msgstr = fmt.Sprintf("%s. %s", msg.Message, strings.Join(outputs, " "))
 
 		case views.HookMsg:
-			switch hook := msg.Hook.(type) {
-			case json.RefreshStart:
-				res := &state.ResourceOperationInfo{
-					Idx:             len(m.refreshInfos) + 1,
-					RawResourceAddr: hook.Resource,
-					Loc: state.ResourceOperationInfoLocator{
-						Module:       hook.Resource.Module,
-						ResourceAddr: hook.Resource.Addr,
-						Action:       "refresh",
-					},
-					Status:    state.ResourceOperationStatusStart,
-					StartTime: msg.TimeStamp,
-				}
-				m.refreshInfos = append(m.refreshInfos, res)
-				msgstr = msg.Message
-
-			case json.RefreshComplete:
-				loc := state.ResourceOperationInfoLocator{
-					Module:       hook.Resource.Module,
-					ResourceAddr: hook.Resource.Addr,
-					Action:       "refresh",
-				}
-				status := state.ResourceOperationStatusComplete
-				update := state.ResourceOperationInfoUpdate{
-					Status:  &status,
-					Endtime: &msg.TimeStamp,
+			msgstr = msg.Message
+			for _, ev := range events {
+				var info *state.ResourceOperationInfo
+				switch ev := ev.(type) {
+				case engine.OperationEvent:
+					if ev.Stage == engine.StageApply {
+						info = ev.Info
+					}
+				case engine.ProvisionerEvent:
+					info = ev.Info
 				}
-				if m.refreshInfos.Update(loc, update) == nil {
-					m.logger.Error("RefreshComplete hook can't find the resource info", "module", hook.Resource.Module, "addr", hook.Resource.Addr, "action", "refresh")
-					break
+				if info != nil {
+					total := m.engine.TotalCount()
+					w := width(total)
+					msgstr = fmt.Sprintf("[%*d/%*d] %s", w, info.Idx, w, total, msg.Message)
 				}
-				msgstr = msg.Message
-
-			case json.OperationStart:
-				info := &state.ResourceOperationInfo{
-					Idx:             len(m.applyInfos) + 1,
-					RawResourceAddr: hook.Resource,
-					Loc: state.ResourceOperationInfoLocator{
-						Module:       hook.Resource.Module,
-						ResourceAddr: hook.Resource.Addr,
-						Action:       string(hook.Action),
-					},
-					Status:    state.ResourceOperationStatusStart,
-					StartTime: msg.TimeStamp,
+			}
+			for _, ev := range events {
+				if ev, ok := ev.(engine.OperationEvent); ok && ev.Stage != engine.StageAux {
+					msgstr += expectedSuffix(ev.Info, msg.TimeStamp)
 				}
-				m.applyInfos = append(m.applyInfos, info)
-
-				w := width(m.totalCnt)
-				msgstr = fmt.Sprintf("[%*d/%*d] %s", w, info.Idx, w, m.totalCnt, msg.Message)
+			}
 
-			case json.OperationProgress:
-				loc := state.ResourceOperationInfoLocator{
-					Module:       hook.Resource.Module,
-					ResourceAddr: hook.Resource.Addr,
-					Action:       string(hook.Action),
-				}
-				info := m.applyInfos.Find(loc)
-				if info == nil {
-					m.logger.Error("OperationProgress hook can't find the resource info", "module", hook.Resource.Module, "addr", hook.Resource.Addr, "action", hook.Action)
-					break
-				}
+		case views.TestAbstractMsg:
+			msgstr = msg.Message
 
-				w := width(m.totalCnt)
-				msgstr = fmt.Sprintf("[%*d/%*d] %s", w, info.Idx, w, m.totalCnt, msg.Message)
+		case views.TestFileMsg:
+			msgstr = msg.Message
 
-			case json.OperationComplete:
-				loc := state.ResourceOperationInfoLocator{
-					Module:       hook.Resource.Module,
-					ResourceAddr: hook.Resource.Addr,
-					Action:       string(hook.Action),
-				}
-				status := state.ResourceOperationStatusComplete
-				update := state.ResourceOperationInfoUpdate{
-					Status:  &status,
-					Endtime: &msg.TimeStamp,
-				}
-				info := m.applyInfos.Update(loc, update)
-				if info == nil {
-					m.logger.Error("OperationComplete hook can't find the resource info", "module", hook.Resource.Module, "addr", hook.Resource.Addr, "action", hook.Action)
-					break
+		case views.TestRunMsg:
+			msgstr = msg.Message
+			for _, ev := range events {
+				if ev, ok := ev.(engine.TestEvent); ok {
+					infos := m.engine.TestInfos()
+					total, _ := infos.RunCount()
+					w := width(total)
+					msgstr = fmt.Sprintf("[%*d/%*d] %s", w, infos.RunIndex(ev.Info.File, ev.Info.Run), w, total, msg.Message)
+					if ev.Info.Progress == json.TestComplete {
+						msgstr += fmt.Sprintf(" (%s)", ev.Info.Duration(msg.TimeStamp))
+					}
 				}
+			}
 
-				w := width(m.totalCnt)
-				msgstr = fmt.Sprintf("[%*d/%*d] %s", w, info.Idx, w, m.totalCnt, msg.Message)
+		case views.TestSummaryMsg:
+			msgstr = msg.Message
 
-			case json.OperationErrored:
-				loc := state.ResourceOperationInfoLocator{
-					Module:       hook.Resource.Module,
-					ResourceAddr: hook.Resource.Addr,
-					Action:       string(hook.Action),
-				}
-				status := state.ResourceOperationStatusErrored
-				update := state.ResourceOperationInfoUpdate{
-					Status:  &status,
-					Endtime: &msg.TimeStamp,
-				}
-				info := m.applyInfos.Update(loc, update)
-				if info == nil {
-					m.logger.Error("OperationErrored hook can't find the resource info", "module", hook.Resource.Module, "addr", hook.Resource.Addr, "action", hook.Action)
-					break
-				}
+		case views.TestPlanMsg, views.TestStateMsg, views.TestCleanupMsg, views.TestInterruptMsg, views.TestStatusMsg, views.TestRetryMsg:
+			msgstr = msg.BaseMessage().Message
 
-				w := width(m.totalCnt)
-				msgstr = fmt.Sprintf("[%*d/%*d] %s", w, info.Idx, w, m.totalCnt, msg.Message)
-
-			case json.ProvisionStart:
-				msgstr = msg.Message
-			case json.ProvisionProgress:
-				msgstr = msg.Message
-			case json.ProvisionComplete:
-				msgstr = msg.Message
-			case json.ProvisionErrored:
-				msgstr = msg.Message
-			default:
-				msgstr = msg.Message
-			}
+		case views.RawLineMsg:
+			// Print as is, e.g. a provider's panic trace
+			msgstr = msg.Message
+
+		case views.UnknownMsg:
+			msgstr = msg.Message
 		}
 
 		m.writer.Write([]byte(msgstr + "\n"))
 	}
 }
 
+// status returns the status line of the operations, if it is during the refresh or the apply.
+func (m *UIModel) status() string {
+	now := m.clock.Now()
+	switch m.engine.Phase() {
+	case engine.PhaseRefresh:
+		infos := m.engine.RefreshInfos()
+		est := estimate.New(infos, 0, now)
+		return fmt.Sprintf("[status] refreshed: %d, in flight: %d, %.1f ops/min", infos.Len()-len(infos.Running()), len(infos.Running()), est.Rate)
+	case engine.PhaseApply:
+		infos := m.engine.ApplyInfos()
+		est := estimate.New(infos, m.engine.TotalCount(), now)
+		s := fmt.Sprintf("[status] done: %d/%d, in flight: %d/%d, %.1f ops/min", m.engine.DoneCount(), m.engine.TotalCount(), len(infos.Running()), m.parallelism, est.Rate)
+		if est.OK {
+			s += fmt.Sprintf(", ETA: %s", est.Remaining)
+		}
+		if n := len(infos.Overdue(now)); n != 0 {
+			s += fmt.Sprintf(", overdue: %d", n)
+		}
+		return s
+	default:
+		return ""
+	}
+}
+
+// expectedSuffix returns the suffix of the hook message about the expected duration of the operation, if any.
+func expectedSuffix(info *state.ResourceOperationInfo, now time.Time) string {
+	exp := info.Expected
+	if exp == nil {
+		return ""
+	}
+	if info.Overdue(now) {
+		return fmt.Sprintf(" [OVERDUE: expected ~%s, p90 %s]", exp.Median, exp.P90)
+	}
+	return fmt.Sprintf(" [expected ~%s]", exp.Median)
+}
+
+// writeDriftSummary writes the resources that have changed outside of Terraform, if any.
+func (m *UIModel) writeDriftSummary() {
+	infos := m.engine.DriftInfos()
+	if len(infos) == 0 {
+		return
+	}
+	lines := []string{fmt.Sprintf("Drifted resources: %d", len(infos))}
+	for _, info := range infos {
+		addr := info.Resource.Addr
+		if info.Resource.Module != "" {
+			addr = fmt.Sprintf("%s (%s)", addr, info.Resource.Module)
+		}
+		lines = append(lines, fmt.Sprintf("  %s: %s", info.Action, addr))
+	}
+	m.writer.Write([]byte(strings.Join(lines, "\n") + "\n"))
+}
+
+// writeConcurrencySummary writes the concurrency analysis of the apply operations, if any.
+func (m *UIModel) writeConcurrencySummary() {
+	lines := concurrency.Analyze(m.engine.ApplyInfos().All(), m.parallelism, m.clock.Now()).Lines()
+	if len(lines) == 0 {
+		return
+	}
+	m.writer.Write([]byte(strings.Join(lines, "\n") + "\n"))
+}
+
 func (m UIModel) IsEOF() bool {
 	return m.isEOF
 }
 
 func (m UIModel) ToCsv() []byte {
-	return csv.ToCsv(csv.Input{
-		RefreshInfos: m.refreshInfos,
-		ApplyInfos:   m.applyInfos,
-	})
+	return csv.ToCsv(m.engine, m.endTime())
+}
+
+func (m UIModel) ToHTML() ([]byte, error) {
+	return report.HTML(m.engine, m.endTime())
+}
+
+// endTime returns the end of the run for the exports, i.e. when the stream reaches EOF. It is the current time if
+// the run is interrupted.
+func (m UIModel) endTime() time.Time {
+	if m.isEOF {
+		return m.eofTime
+	}
+	return m.clock.Now()
+}
+
+func (m UIModel) ToTrace() ([]byte, error) {
+	return trace.JSON(m.engine, m.endTime())
+}
+
+func (m UIModel) ToSpans() *otlp.Span {
+	return otlp.Spans(m.engine, m.endTime())
 }
 
 func decorateMsg(level, msg string) string {
@@ -0,0 +1,93 @@
+package reader
+
+import (
+	"sync"
+
+	"github.com/magodo/pipeform/terraform/views"
+)
+
+// DefaultBufferSize is the default size of the message buffer of the AsyncReader.
+const DefaultBufferSize = 4096
+
+// AsyncReader reads (and decodes) the messages in a dedicated goroutine into a buffered channel, so that the
+// stream keeps being drained even when the consumer falls behind.
+type AsyncReader struct {
+	r    MessageReader
+	ch   chan result
+	once sync.Once
+
+	// err is the terminal error (e.g. io.EOF) received from the channel
+	err error
+}
+
+type result struct {
+	msg views.Message
+	err error
+}
+
+var _ MessageReader = &AsyncReader{}
+
+// NewAsyncReader creates an AsyncReader, the reading goroutine starts on the first read.
+func NewAsyncReader(r MessageReader, bufferSize int) *AsyncReader {
+	return &AsyncReader{
+		r:  r,
+		ch: make(chan result, bufferSize),
+	}
+}
+
+func (r *AsyncReader) start() {
+	r.once.Do(func() {
+		go func() {
+			defer close(r.ch)
+			for {
+				msg, err := r.r.Next()
+				r.ch <- result{msg: msg, err: err}
+				if err != nil {
+					return
+				}
+			}
+		}()
+	})
+}
+
+// Next blocks until the next message is read.
+// Otherwise, it returns either the io.EOF error, or others.
+func (r *AsyncReader) Next() (views.Message, error) {
+	msgs, err := r.NextBatch(1)
+	if len(msgs) != 0 {
+		return msgs[0], nil
+	}
+	return nil, err
+}
+
+// NextBatch blocks until there is any message read, then returns up to max messages that are available without blocking.
+// The error (e.g. io.EOF) is returned together with the messages read before it.
+// Once an error is returned, the following calls keep returning the same error.
+func (r *AsyncReader) NextBatch(max int) ([]views.Message, error) {
+	r.start()
+
+	if r.err != nil {
+		return nil, r.err
+	}
+
+	res := <-r.ch
+	if res.err != nil {
+		r.err = res.err
+		return nil, r.err
+	}
+	msgs := []views.Message{res.msg}
+
+	for len(msgs) < max {
+		select {
+		case res := <-r.ch:
+			if res.err != nil {
+				r.err = res.err
+				return msgs, r.err
+			}
+			msgs = append(msgs, res.msg)
+		default:
+			return msgs, nil
+		}
+	}
+	return msgs, nil
+}
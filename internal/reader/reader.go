@@ -1,34 +1,117 @@
 package reader
 
 import (
-	"bufio"
+	"errors"
+	"fmt"
 	"io"
 
-	"github.com/magodo/pipeform/internal/terraform/views"
+	"github.com/magodo/pipeform/terraform/views"
+	"github.com/magodo/pipeform/terraform/views/json"
 )
 
+// DefaultMaxMessageSize is the default maximum size of a single message (i.e. a line) in the stream.
+const DefaultMaxMessageSize = views.DefaultMaxMessageSize
+
+// MessageReader reads the messages one by one.
+type MessageReader interface {
+	// Next returns the message.
+	// Otherwise, it returns either the io.EOF error, or others.
+	Next() (views.Message, error)
+}
+
+// Reader reads the messages from the stream via the views.Decoder, and tees the stream as is.
 type Reader struct {
-	scanner   *bufio.Scanner
-	teeWriter io.Writer
+	dec *views.Decoder
+	tee *teeWriter
+}
+
+type Option func(*options)
+
+type options struct {
+	maxMessageSize int
+}
+
+// WithMaxMessageSize sets the maximum size of a single message, a larger message is skipped with a warning diagnostic.
+func WithMaxMessageSize(size int) Option {
+	return func(o *options) {
+		o.maxMessageSize = size
+	}
 }
 
-func NewReader(r io.Reader, teeWriter io.Writer) Reader {
-	return Reader{
-		scanner:   bufio.NewScanner(r),
-		teeWriter: teeWriter,
+func NewReader(r io.Reader, tee io.Writer, opts ...Option) *Reader {
+	o := options{
+		maxMessageSize: DefaultMaxMessageSize,
 	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	reader := &Reader{}
+	if tee != nil {
+		reader.tee = &teeWriter{w: tee}
+		r = io.TeeReader(r, reader.tee)
+	}
+	reader.dec = views.NewDecoder(r, views.WithMaxMessageSize(o.maxMessageSize))
+	return reader
 }
 
-// Next returns the message.
+// Next returns the message. The line that can't be unmarshaled as a Terraform message is returned as a views.RawLineMsg.
+// The line that exceeds the max message size is skipped, and a warning views.DiagnosticsMsg is returned instead.
 // Otherwise, it returns either the io.EOF error, or others.
 func (r *Reader) Next() (views.Message, error) {
-	if r.scanner.Scan() {
-		line := r.scanner.Text()
-		io.WriteString(r.teeWriter, line+"\n")
-		return views.UnmarshalMessage([]byte(line))
+	msg, err := r.dec.Decode()
+	if err == nil {
+		return msg, nil
+	}
+
+	var lineErr *views.LineError
+	if errors.As(err, &lineErr) {
+		return views.NewRawLineMsg(string(lineErr.Line)), nil
 	}
-	if err := r.scanner.Err(); err != nil {
-		return nil, err
+
+	var sizeErr *views.MessageTooLargeError
+	if errors.As(err, &sizeErr) {
+		return oversizedMessage(sizeErr), nil
+	}
+
+	// Ensure the tee'd stream ends with a newline, so that it can be appended by a following run.
+	if err == io.EOF && r.tee != nil {
+		r.tee.terminate()
+	}
+	return nil, err
+}
+
+// teeWriter tracks the last byte written, in order to terminate the last line.
+type teeWriter struct {
+	w    io.Writer
+	last byte
+}
+
+func (t *teeWriter) Write(p []byte) (int, error) {
+	if len(p) != 0 {
+		t.last = p[len(p)-1]
+	}
+	return t.w.Write(p)
+}
+
+func (t *teeWriter) terminate() {
+	if t.last != 0 && t.last != '\n' {
+		t.Write([]byte("\n"))
+	}
+}
+
+func oversizedMessage(err *views.MessageTooLargeError) views.DiagnosticsMsg {
+	summary := "Oversized message skipped"
+	return views.DiagnosticsMsg{
+		BaseMsg: views.BaseMsg{
+			Level:   "warn",
+			Message: summary,
+			Type:    json.MessageDiagnostic,
+		},
+		Diagnostic: &json.Diagnostic{
+			Severity: json.DiagnosticSeverityWarning,
+			Summary:  summary,
+			Detail:   fmt.Sprintf("A message of %d bytes exceeds the maximum message size of %d bytes.", err.Size, err.Max),
+		},
 	}
-	return nil, io.EOF
 }
@@ -3,13 +3,15 @@ package reader_test
 import (
 	"bytes"
 	"encoding/json"
+	"fmt"
 	"io"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/magodo/pipeform/internal/reader"
-	"github.com/magodo/pipeform/internal/terraform/views"
-	vjson "github.com/magodo/pipeform/internal/terraform/views/json"
+	"github.com/magodo/pipeform/terraform/views"
+	vjson "github.com/magodo/pipeform/terraform/views/json"
 	"github.com/stretchr/testify/require"
 	"github.com/zclconf/go-cty/cty"
 	ctyjson "github.com/zclconf/go-cty/cty/json"
@@ -174,3 +176,141 @@ func TestReader(t *testing.T) {
 	_, err = reader.Next()
 	require.Equal(t, io.EOF, err)
 }
+
+func TestReaderRawLine(t *testing.T) {
+	inputs := []string{
+		`{"@level":"info","@message":"Terraform 1.10.3","@module":"terraform.ui","@timestamp":"2025-01-10T10:00:00Z","terraform":"1.10.3","type":"version","ui":"1.2"}`,
+		`panic: runtime error: invalid memory address or nil pointer dereference`,
+		``,
+		`goroutine 1 [running]:`,
+	}
+
+	buf := bytes.NewBuffer([]byte{})
+	for _, input := range inputs {
+		buf.WriteString(input + "\n")
+	}
+	reader := reader.NewReader(buf, io.Discard)
+
+	msg, err := reader.Next()
+	require.NoError(t, err)
+	require.IsType(t, views.VersionMsg{}, msg)
+
+	msg, err = reader.Next()
+	require.NoError(t, err)
+	require.Equal(t, views.NewRawLineMsg(inputs[1]), msg)
+
+	// The empty line is skipped
+	msg, err = reader.Next()
+	require.NoError(t, err)
+	require.Equal(t, views.NewRawLineMsg(inputs[3]), msg)
+
+	_, err = reader.Next()
+	require.Equal(t, io.EOF, err)
+}
+
+func TestReaderLongLine(t *testing.T) {
+	// The output value exceeds the default token size (64KiB) of bufio.Scanner
+	value := strings.Repeat("x", 100*1024)
+	inputs := []string{
+		`{"@level":"info","@message":"Outputs: 1","@module":"terraform.ui","@timestamp":"2025-01-10T10:00:00Z","outputs":{"large":{"sensitive":false,"type":"string","value":"` + value + `"}},"type":"outputs"}`,
+		`{"@level":"info","@message":"Outputs: 1","@module":"terraform.ui","@timestamp":"2025-01-10T10:00:00Z","outputs":{"larger":{"sensitive":false,"type":"string","value":"` + value + value + `"}},"type":"outputs"}`,
+		`{"@level":"info","@message":"Terraform 1.10.3","@module":"terraform.ui","@timestamp":"2025-01-10T10:00:00Z","terraform":"1.10.3","type":"version","ui":"1.2"}`,
+	}
+
+	buf := bytes.NewBuffer([]byte{})
+	for _, input := range inputs {
+		buf.WriteString(input + "\n")
+	}
+	var tee bytes.Buffer
+	reader := reader.NewReader(buf, &tee, reader.WithMaxMessageSize(150*1024))
+
+	msg, err := reader.Next()
+	require.NoError(t, err)
+	require.Equal(t, json.RawMessage(`"`+value+`"`), msg.(views.OutputMsg).Outputs["large"].Value)
+
+	// The oversized message is skipped with a warning
+	msg, err = reader.Next()
+	require.NoError(t, err)
+	require.Equal(t, vjson.DiagnosticSeverityWarning, msg.(views.DiagnosticsMsg).Diagnostic.Severity)
+
+	msg, err = reader.Next()
+	require.NoError(t, err)
+	require.IsType(t, views.VersionMsg{}, msg)
+
+	_, err = reader.Next()
+	require.Equal(t, io.EOF, err)
+
+	// The tee'd stream is identical to the input, including the oversized message
+	require.Equal(t, strings.Join(inputs, "\n")+"\n", tee.String())
+}
+
+func TestReplayer(t *testing.T) {
+	inputs := []string{
+		`{"@level":"info","@message":"Terraform 1.10.3","@module":"terraform.ui","@timestamp":"2025-01-10T10:00:00Z","terraform":"1.10.3","type":"version","ui":"1.2"}`,
+		`{"@level":"info","@message":"Plan: 1 to add, 0 to change, 0 to destroy.","@module":"terraform.ui","@timestamp":"2025-01-10T11:00:00Z","changes":{"add":1,"change":0,"remove":0,"operation":"plan"},"type":"change_summary"}`,
+		`{"@level":"info","@message":"Apply complete! Resources: 1 added, 0 changed, 0 destroyed.","@module":"terraform.ui","@timestamp":"2025-01-10T12:00:00Z","changes":{"add":1,"change":0,"remove":0,"operation":"apply"},"type":"change_summary"}`,
+	}
+
+	buf := bytes.NewBuffer([]byte{})
+	for _, input := range inputs {
+		buf.WriteString(input + "\n")
+	}
+	replayer := reader.NewReplayer(reader.NewReader(buf, io.Discard), 1)
+
+	// The hour long gaps are skipped until the apply change summary
+	var skipped int
+	replayer.SkipUntil(func(msg views.Message) bool {
+		skipped++
+		return msg.(views.ChangeSummaryMsg).Changes.Operation == vjson.OperationApplied
+	})
+
+	msg, err := replayer.Next()
+	require.NoError(t, err)
+	require.Equal(t, mustUnmarshalTime(t, `"2025-01-10T10:00:00Z"`), replayer.Now().Truncate(time.Minute))
+	require.IsType(t, views.VersionMsg{}, msg)
+
+	for i := 0; i < 2; i++ {
+		_, err := replayer.Next()
+		require.NoError(t, err)
+	}
+	require.Equal(t, 2, skipped)
+
+	// The virtual clock is frozen when paused
+	require.True(t, replayer.TogglePause())
+	now := replayer.Now()
+	require.Equal(t, mustUnmarshalTime(t, `"2025-01-10T12:00:00Z"`), now.Truncate(time.Second))
+	time.Sleep(10 * time.Millisecond)
+	require.Equal(t, now, replayer.Now())
+
+	_, err = replayer.Next()
+	require.Equal(t, io.EOF, err)
+}
+
+func TestAsyncReader(t *testing.T) {
+	buf := bytes.NewBuffer([]byte{})
+	for i := 0; i < 10; i++ {
+		fmt.Fprintf(buf, "line %d\n", i)
+	}
+	r := reader.NewAsyncReader(reader.NewReader(buf, io.Discard), 16)
+
+	msg, err := r.Next()
+	require.NoError(t, err)
+	require.Equal(t, views.NewRawLineMsg("line 0"), msg)
+
+	var msgs []views.Message
+	for {
+		batch, err := r.NextBatch(4)
+		require.LessOrEqual(t, len(batch), 4)
+		msgs = append(msgs, batch...)
+		if err != nil {
+			require.Equal(t, io.EOF, err)
+			break
+		}
+	}
+	require.Len(t, msgs, 9)
+	require.Equal(t, views.NewRawLineMsg("line 9"), msgs[8])
+
+	// The terminal error is kept
+	_, err = r.Next()
+	require.Equal(t, io.EOF, err)
+}
@@ -0,0 +1,145 @@
+package reader
+
+import (
+	"sync"
+	"time"
+
+	"github.com/magodo/pipeform/terraform/views"
+)
+
+// Replayer replays the messages read from a recorded stream, by re-emitting them according to the gaps
+// between their timestamps. It runs on a virtual clock, which reflects the recorded time of the stream.
+type Replayer struct {
+	r MessageReader
+	// speed is the multiplier of the replay speed. A non-positive speed means no delay at all.
+	speed float64
+
+	// wake is used to wake up the Next() waiting for the next message, on any control change.
+	wake chan struct{}
+
+	mu     sync.Mutex
+	paused bool
+	eof    bool
+	// skip is the predicate for fast forwarding, until it returns true for a message.
+	skip func(views.Message) bool
+
+	// The virtual time is calculated as: base + (wall now - baseAt) * speed
+	base   time.Time
+	baseAt time.Time
+}
+
+var _ MessageReader = &Replayer{}
+
+// NewReplayer creates a replayer with the speed multiplier. A non-positive speed replays the messages without
+// any delay, in which case the virtual clock reflects the timestamp of the latest message.
+func NewReplayer(r MessageReader, speed float64) *Replayer {
+	return &Replayer{
+		r:     r,
+		speed: speed,
+		wake:  make(chan struct{}, 1),
+	}
+}
+
+// Now returns the virtual time of the replay. It implements the clock.Clock interface.
+func (r *Replayer) Now() time.Time {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.now(time.Now())
+}
+
+func (r *Replayer) now(wallNow time.Time) time.Time {
+	if r.paused || r.eof || r.speed <= 0 || r.base.IsZero() {
+		return r.base
+	}
+	return r.base.Add(time.Duration(float64(wallNow.Sub(r.baseAt)) * r.speed))
+}
+
+// TogglePause pauses or resumes the replay, returns whether the replay is paused afterwards.
+func (r *Replayer) TogglePause() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	wallNow := time.Now()
+	if r.paused {
+		r.baseAt = wallNow
+		r.paused = false
+	} else {
+		r.base = r.now(wallNow)
+		r.paused = true
+	}
+	r.notify()
+	return r.paused
+}
+
+// SkipUntil emits the following messages immediately, until the predicate returns true for a message.
+// That message is emitted immediately as well, and the replay continues with its original timing afterwards.
+func (r *Replayer) SkipUntil(pred func(views.Message) bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.skip = pred
+	r.notify()
+}
+
+func (r *Replayer) notify() {
+	select {
+	case r.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (r *Replayer) Next() (views.Message, error) {
+	msg, err := r.r.Next()
+	if err != nil {
+		r.mu.Lock()
+		r.eof = true
+		r.mu.Unlock()
+		return nil, err
+	}
+
+	ts := msg.BaseMessage().TimeStamp
+	if ts.IsZero() {
+		return msg, nil
+	}
+
+	for {
+		r.mu.Lock()
+		wallNow := time.Now()
+		if r.base.IsZero() {
+			break
+		}
+		if r.skip != nil {
+			if r.skip(msg) {
+				r.skip = nil
+			}
+			break
+		}
+		if r.speed <= 0 {
+			break
+		}
+		if r.paused {
+			r.mu.Unlock()
+			<-r.wake
+			continue
+		}
+		remaining := ts.Sub(r.now(wallNow))
+		if remaining <= 0 {
+			break
+		}
+		r.mu.Unlock()
+
+		timer := time.NewTimer(time.Duration(float64(remaining) / r.speed))
+		select {
+		case <-timer.C:
+		case <-r.wake:
+			timer.Stop()
+		}
+	}
+
+	// The lock is held here
+	if ts.After(r.base) {
+		r.base = ts
+	}
+	r.baseAt = time.Now()
+	r.mu.Unlock()
+
+	return msg, nil
+}
@@ -0,0 +1,155 @@
+// Package report renders the run as a self-contained HTML report, which has no external assets so that it can be
+// viewed offline, e.g. as a CI artifact.
+package report
+
+import (
+	"bytes"
+	_ "embed"
+	"fmt"
+	"html/template"
+	"slices"
+	"time"
+
+	"github.com/charmbracelet/bubbles/table"
+	"github.com/magodo/pipeform/internal/concurrency"
+	"github.com/magodo/pipeform/internal/diag"
+	"github.com/magodo/pipeform/internal/engine"
+	"github.com/magodo/pipeform/internal/state"
+	"github.com/magodo/pipeform/terraform/views/json"
+)
+
+//go:embed report.html.tmpl
+var reportTmpl string
+
+var tmpl = template.Must(template.New("report").Parse(reportTmpl))
+
+type data struct {
+	Version   string
+	Operation string
+	Changes   *json.ChangeSummary
+	Start     string
+	Duration  time.Duration
+	Warnings  int
+	Errors    int
+
+	Span time.Duration
+	Ops  []op
+
+	// Plans are the rows of the plan table, i.e. index, module, resource, action and comment
+	Plans   []table.Row
+	Diags   []diagnostic
+	Outputs []output
+}
+
+// op is an operation in the Gantt chart, whose position is in percentage of the span.
+type op struct {
+	Stage    string
+	Action   string
+	Module   string
+	Addr     string
+	Status   string
+	Duration time.Duration
+	Offset   time.Duration
+	Left     float64
+	Width    float64
+	Critical bool
+}
+
+type diagnostic struct {
+	Severity string
+	Rendered string
+}
+
+type output struct {
+	Name  string
+	Type  string
+	Value string
+}
+
+// HTML renders the report of the run recorded by the engine. The now is used to calculate the duration of the
+// in-progress operations.
+func HTML(e *engine.Engine, now time.Time) ([]byte, error) {
+	warnings, errors := e.Diags().Count()
+	d := data{
+		Version:   e.Version(),
+		Operation: string(e.Operation()),
+		Changes:   e.ChangeSummary(),
+		Warnings:  warnings,
+		Errors:    errors,
+		Plans:     e.PlanInfos().ToRows(),
+	}
+	if start := e.StartTime(); !start.IsZero() {
+		d.Start = start.Format(time.RFC3339)
+		d.Duration = now.Sub(start).Truncate(time.Second)
+	}
+
+	d.Span, d.Ops = gantt(e.RefreshInfos(), e.ApplyInfos(), now)
+
+	for _, dg := range e.Diags() {
+		d.Diags = append(d.Diags, diagnostic{
+			Severity: string(dg.Severity),
+			Rendered: diag.Render(dg),
+		})
+	}
+
+	for _, o := range e.OutputInfos() {
+		value := string(o.ValueStr)
+		if o.Sensitive {
+			value = "(sensitive)"
+		}
+		d.Outputs = append(d.Outputs, output{Name: o.Name, Type: o.Type, Value: value})
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, d); err != nil {
+		return nil, fmt.Errorf("rendering HTML report: %v", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// gantt returns the span of the operations and their positions in it. The in-progress operations end at now.
+func gantt(refreshInfos, applyInfos state.ResourceOperationInfos, now time.Time) (time.Duration, []op) {
+	all := slices.Concat(refreshInfos.All(), applyInfos.All())
+	if len(all) == 0 {
+		return 0, nil
+	}
+
+	var start, end time.Time
+	for _, info := range all {
+		if start.IsZero() || info.StartTime.Before(start) {
+			start = info.StartTime
+		}
+		if e := info.StartTime.Add(info.Duration(now)); e.After(end) {
+			end = e
+		}
+	}
+	span := max(end.Sub(start), time.Second)
+
+	critical := map[*state.ResourceOperationInfo]bool{}
+	for _, info := range concurrency.CriticalPath(all, now) {
+		critical[info] = true
+	}
+
+	var ops []op
+	add := func(stage engine.Stage, infos state.ResourceOperationInfos) {
+		for _, info := range infos.All() {
+			offset := info.StartTime.Sub(start)
+			dur := info.Duration(now)
+			ops = append(ops, op{
+				Stage:    string(stage),
+				Action:   info.Loc.Action,
+				Module:   info.Loc.Module,
+				Addr:     info.Loc.ResourceAddr,
+				Status:   string(info.Status),
+				Duration: dur,
+				Offset:   offset,
+				Left:     float64(offset) / float64(span) * 100,
+				Width:    float64(dur) / float64(span) * 100,
+				Critical: critical[info],
+			})
+		}
+	}
+	add(engine.StageRefresh, refreshInfos)
+	add(engine.StageApply, applyInfos)
+	return span, ops
+}
@@ -0,0 +1,45 @@
+package report_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/magodo/pipeform/internal/enginetest"
+	"github.com/magodo/pipeform/internal/report"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHTML(t *testing.T) {
+	e, _ := enginetest.Apply(t, "apply.jsonl")
+
+	b, err := report.HTML(e, time.Date(2025, 1, 10, 10, 0, 20, 0, time.UTC))
+	require.NoError(t, err)
+	out := string(b)
+
+	// No external assets
+	require.NotContains(t, out, "<link")
+	require.NotContains(t, out, "src=")
+
+	// Header
+	require.Contains(t, out, "<td>Terraform 1.10.3</td>")
+	require.Contains(t, out, "<td>3 to add, 0 to change, 0 to import, 1 to destroy</td>")
+	require.Contains(t, out, "<td>19s</td>")
+
+	// Gantt chart, where the refresh takes 1s of the 14s span
+	require.Contains(t, out, `<div class="gantt-row refresh critical">`)
+	require.Contains(t, out, `<div class="gantt-bar complete" style="left: 0.000%; width: 7.143%" title="refresh random_pet.dog: complete, 1s from +0s">`)
+	require.Contains(t, out, `<div class="gantt-bar error"`)
+
+	// Planned changes with the reason
+	require.Contains(t, out, "<td>replace</td><td>cannot_update</td>")
+
+	// Diagnostics with the snippet rendered
+	require.Contains(t, out, `<pre class="error">`)
+	require.Contains(t, out, "Error: local-exec provisioner error")
+
+	// Outputs with the sensitive value masked
+	require.Contains(t, out, "<td>pet</td><td>string</td><td><code>&#34;good-dog&#34;</code></td>")
+	require.Contains(t, out, "<td>cat</td><td>string</td><td><code>(sensitive)</code></td>")
+	require.Equal(t, 1, strings.Count(out, "(sensitive)"))
+}
@@ -0,0 +1,150 @@
+// Package runner runs the Terraform command (or a wrapper of it, e.g. atmos, tofu) as a child process,
+// so that pipeform can consume its machine readable UI output and control its lifecycle.
+package runner
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+)
+
+type Runner struct {
+	cmd    *exec.Cmd
+	stdout io.ReadCloser
+	stderr *syncBuffer
+}
+
+// New creates a runner for the command specified by args, which is expected to be something like
+// "terraform apply -auto-approve". The "-json" flag is added if it is missing.
+//
+// If stderr is nil, the stderr of the child process is buffered and can be retrieved via Stderr().
+func New(args []string, stderr io.Writer) (*Runner, error) {
+	if len(args) == 0 {
+		return nil, errors.New("no command specified")
+	}
+	args = EnsureJSONFlag(args)
+
+	cmd := exec.Command(args[0], args[1:]...)
+	// The child process doesn't need stdin, as we are expecting it to run in a non-interactive manner (-json).
+	cmd.Stdin = nil
+	cmd.SysProcAttr = sysProcAttr()
+
+	r := &Runner{
+		cmd: cmd,
+	}
+
+	if stderr == nil {
+		r.stderr = &syncBuffer{}
+		stderr = r.stderr
+	}
+	cmd.Stderr = stderr
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	r.stdout = stdout
+
+	return r, nil
+}
+
+// Args returns the actual arguments (including the program) to run.
+func (r *Runner) Args() []string {
+	return r.cmd.Args
+}
+
+// Start starts the child process, returns the reader of its stdout.
+func (r *Runner) Start() (io.Reader, error) {
+	if err := r.cmd.Start(); err != nil {
+		return nil, err
+	}
+	return r.stdout, nil
+}
+
+// Wait waits for the child process to exit. It must be called after the stdout has been read to EOF.
+func (r *Runner) Wait() error {
+	return r.cmd.Wait()
+}
+
+// Signal forwards the signal to the child process.
+func (r *Runner) Signal(sig os.Signal) error {
+	if r.cmd.Process == nil {
+		return errors.New("process not started")
+	}
+	return signal(r.cmd.Process, sig)
+}
+
+// Interrupt sends a graceful interrupt to the child process, which gives Terraform the chance to
+// stop the in-flight operations and persist the state.
+func (r *Runner) Interrupt() error {
+	return r.Signal(os.Interrupt)
+}
+
+// Kill kills the child process (and its descendants, e.g. the provider plugins, if supported) immediately.
+func (r *Runner) Kill() error {
+	if r.cmd.Process == nil {
+		return errors.New("process not started")
+	}
+	return kill(r.cmd.Process)
+}
+
+// Stderr returns the buffered stderr output of the child process.
+// It returns nil if the stderr is redirected to a user specified writer.
+func (r *Runner) Stderr() []byte {
+	if r.stderr == nil {
+		return nil
+	}
+	return r.stderr.Bytes()
+}
+
+// EnsureJSONFlag adds the "-json" flag to the command arguments, if it is missing.
+//
+// For terraform/tofu, the flag is inserted right after the subcommand (e.g. "apply"), since any
+// positional argument (e.g. a plan file) stops the flag parsing of Terraform.
+// For atmos, the flag is appended after the "--" separator, which is passed through to Terraform.
+func EnsureJSONFlag(args []string) []string {
+	if slices.Contains(args, "-json") || slices.Contains(args, "--json") {
+		return args
+	}
+
+	args = slices.Clone(args)
+
+	program := strings.TrimSuffix(filepath.Base(args[0]), filepath.Ext(args[0]))
+	if program == "atmos" {
+		if !slices.Contains(args, "--") {
+			args = append(args, "--")
+		}
+		return append(args, "-json")
+	}
+
+	// Skip the global options (e.g. -chdir=...) and find the subcommand.
+	for i := 1; i < len(args); i++ {
+		if !strings.HasPrefix(args[i], "-") {
+			return slices.Insert(args, i+1, "-json")
+		}
+	}
+	return append(args, "-json")
+}
+
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) Bytes() []byte {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return slices.Clone(b.buf.Bytes())
+}
@@ -0,0 +1,24 @@
+//go:build !windows
+
+package runner
+
+import (
+	"os"
+	"syscall"
+)
+
+// sysProcAttr puts the child process into its own process group, so that the SIGINT generated by
+// the terminal (e.g. ctrl-c in the plain UI) only reaches pipeform, which then forwards it to the child.
+// Otherwise, the child would receive it twice, which Terraform treats as a hard interrupt.
+func sysProcAttr() *syscall.SysProcAttr {
+	return &syscall.SysProcAttr{Setpgid: true}
+}
+
+func signal(p *os.Process, sig os.Signal) error {
+	return p.Signal(sig)
+}
+
+// kill kills the whole process group of the child process.
+func kill(p *os.Process) error {
+	return syscall.Kill(-p.Pid, syscall.SIGKILL)
+}
@@ -0,0 +1,22 @@
+//go:build windows
+
+package runner
+
+import (
+	"os"
+	"syscall"
+)
+
+func sysProcAttr() *syscall.SysProcAttr {
+	return nil
+}
+
+// signal on Windows can only kill the process, as sending an interrupt to a child process
+// is not supported by the os package.
+func signal(p *os.Process, sig os.Signal) error {
+	return p.Kill()
+}
+
+func kill(p *os.Process) error {
+	return p.Kill()
+}
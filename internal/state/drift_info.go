@@ -0,0 +1,51 @@
+package state
+
+import (
+	"strconv"
+
+	"github.com/charmbracelet/bubbles/table"
+	"github.com/magodo/pipeform/terraform/views/json"
+)
+
+// DriftInfo is a resource that has changed outside of Terraform, as detected during the refresh.
+type DriftInfo struct {
+	Resource json.ResourceAddr
+	Action   json.ChangeAction
+}
+
+type DriftInfos []*DriftInfo
+
+func (infos DriftInfos) ToRows() []table.Row {
+	var rows []table.Row
+	for i, info := range infos {
+		module := "-"
+		if info.Resource.Module != "" {
+			module = info.Resource.Module
+		}
+		row := []string{
+			strconv.Itoa(i + 1),
+			module,
+			info.Resource.Addr,
+			string(info.Action),
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+func (infos DriftInfos) ToColumns(width int) []table.Column {
+	const indexWidth = 6
+	const actionWidth = 8
+
+	dynamicWidth := width - indexWidth - actionWidth
+
+	moduleWidth := dynamicWidth / 3
+	resourceWidth := dynamicWidth / 2
+
+	return []table.Column{
+		{Title: "Index", Width: indexWidth},
+		{Title: "Module", Width: moduleWidth},
+		{Title: "Resource", Width: resourceWidth},
+		{Title: "Action", Width: actionWidth},
+	}
+}
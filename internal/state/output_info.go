@@ -6,7 +6,7 @@ import (
 	"strconv"
 
 	"github.com/charmbracelet/bubbles/table"
-	"github.com/magodo/pipeform/internal/terraform/views/json"
+	"github.com/magodo/pipeform/terraform/views/json"
 )
 
 type OutputInfo struct {
@@ -2,12 +2,13 @@ package state
 
 import (
 	"fmt"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/charmbracelet/bubbles/table"
-	"github.com/magodo/pipeform/internal/terraform/views/json"
+	"github.com/magodo/pipeform/terraform/views/json"
 )
 
 type ResourceOperationStatus string
@@ -19,9 +20,12 @@ const (
 	ResourceOperationStatusComplete ResourceOperationStatus = "complete"
 	// Once received one OperationErrored hook message
 	ResourceOperationStatusErrored ResourceOperationStatus = "error"
+	// Once received one ProvisionStart hook message, until the ProvisionComplete or ProvisionErrored hook message
+	ResourceOperationStatusProvisioning ResourceOperationStatus = "provisioning"
+	// Once received one PlannedChange message, until the OperationStart hook message
+	ResourceOperationStatusPending ResourceOperationStatus = "pending"
 
 	// TODO: Support refresh? (refresh is an independent lifecycle than the resource apply lifecycle)
-	// TODO: Support provision? (provision is a intermidiate stage in the resource apply lifecycle)
 )
 
 func resourceOperationStatusEmoji(status ResourceOperationStatus) string {
@@ -32,11 +36,18 @@ func resourceOperationStatusEmoji(status ResourceOperationStatus) string {
 		return "✅"
 	case ResourceOperationStatusErrored:
 		return "❌"
+	case ResourceOperationStatusProvisioning:
+		return "🔧"
+	case ResourceOperationStatusPending:
+		return "⏳"
 	default:
 		return "❓"
 	}
 }
 
+// overdueEmoji replaces the status emoji of the operations running well past their expected duration.
+const overdueEmoji = "🐢"
+
 type ResourceOperationInfoLocator struct {
 	Module       string
 	ResourceAddr string
@@ -50,6 +61,78 @@ type ResourceOperationInfo struct {
 	Status          ResourceOperationStatus
 	StartTime       time.Time
 	EndTime         time.Time
+
+	// IDKey and IDValue are the id of the resource, e.g. "id" and the cloud resource id, if told by the hooks.
+	// The id of a resource to create is only known after the operation completes.
+	IDKey   string
+	IDValue string
+
+	// Provisioners are the provisioner steps run during the operation, in order.
+	Provisioners []*ProvisionerInfo
+
+	// Diags are the diagnostics whose address is the resource, e.g. the error of an errored operation.
+	Diags []json.Diagnostic
+
+	// Expected is the duration expected from the history runs, if any.
+	Expected *ExpectedDuration
+}
+
+// ExpectedDuration is the duration of an operation, expected from the same operations of the history runs.
+type ExpectedDuration struct {
+	Median time.Duration
+	P90    time.Duration
+}
+
+// overdueSlack is the time allowed beyond the p90 duration, so that the short operations aren't reported as overdue
+// due to the noise.
+const overdueSlack = 10 * time.Second
+
+// Overdue tells whether the operation is still running well past its expected p90 duration, which might indicate
+// a hanging provider.
+func (info ResourceOperationInfo) Overdue(now time.Time) bool {
+	if info.Expected == nil {
+		return false
+	}
+	if info.Status != ResourceOperationStatusStart && info.Status != ResourceOperationStatusProvisioning {
+		return false
+	}
+	return info.Duration(now) > info.Expected.P90+overdueSlack
+}
+
+// ProvisionerInfo records a provisioner step (e.g. local-exec) of a resource operation.
+type ProvisionerInfo struct {
+	Provisioner string
+	// Status is one of start, complete and error
+	Status    ResourceOperationStatus
+	StartTime time.Time
+	EndTime   time.Time
+	// Output are the output lines of the provisioner
+	Output []string
+}
+
+func (info ProvisionerInfo) Duration(now time.Time) time.Duration {
+	if info.EndTime.Equal(time.Time{}) {
+		return now.Sub(info.StartTime).Truncate(time.Second)
+	}
+	return info.EndTime.Sub(info.StartTime).Truncate(time.Second)
+}
+
+// RunningProvisioner returns the last provisioner step if it is still running.
+func (info ResourceOperationInfo) RunningProvisioner() *ProvisionerInfo {
+	if n := len(info.Provisioners); n != 0 && info.Provisioners[n-1].Status == ResourceOperationStatusStart {
+		return info.Provisioners[n-1]
+	}
+	return nil
+}
+
+// HasErroredProvisioner tells whether any provisioner step has errored.
+func (info ResourceOperationInfo) HasErroredProvisioner() bool {
+	for _, p := range info.Provisioners {
+		if p.Status == ResourceOperationStatusErrored {
+			return true
+		}
+	}
+	return false
 }
 
 type ResourceOperationInfoUpdate struct {
@@ -58,15 +141,77 @@ type ResourceOperationInfoUpdate struct {
 }
 
 // ResourceOperationInfos records the operation information for each resource's action.
-type ResourceOperationInfos []*ResourceOperationInfo
+// The infos are kept in the insertion order for display, and indexed by their locators.
+// Besides, the planned operations that haven't started yet are kept as pending, until the infos of the same
+// locators are added.
+// The zero value is ready to use.
+type ResourceOperationInfos struct {
+	infos []*ResourceOperationInfo
+	index map[ResourceOperationInfoLocator]*ResourceOperationInfo
+	// latest indexes the latest info of each resource by its absolute address, regardless of the action
+	latest map[string]*ResourceOperationInfo
 
-func (infos ResourceOperationInfos) Find(loc ResourceOperationInfoLocator) *ResourceOperationInfo {
-	for _, info := range infos {
-		if info.Loc == loc {
-			return info
+	// pending are the pending infos in the planned order, including the ones that have started since,
+	// which are no longer in the pendingIndex.
+	pending      []*ResourceOperationInfo
+	pendingIndex map[ResourceOperationInfoLocator]*ResourceOperationInfo
+}
+
+// Add appends the info. If there is already an info with the same locator, the index then points to the new one.
+// The pending info of the same locator, if any, is removed.
+func (infos *ResourceOperationInfos) Add(info *ResourceOperationInfo) {
+	if infos.index == nil {
+		infos.index = map[ResourceOperationInfoLocator]*ResourceOperationInfo{}
+		infos.latest = map[string]*ResourceOperationInfo{}
+	}
+	infos.infos = append(infos.infos, info)
+	infos.index[info.Loc] = info
+	infos.latest[info.Loc.ResourceAddr] = info
+	delete(infos.pendingIndex, info.Loc)
+}
+
+// AddPending adds a pending info for a planned operation, unless there is already one of the same locator.
+func (infos *ResourceOperationInfos) AddPending(info *ResourceOperationInfo) {
+	if infos.pendingIndex == nil {
+		infos.pendingIndex = map[ResourceOperationInfoLocator]*ResourceOperationInfo{}
+	}
+	if _, ok := infos.pendingIndex[info.Loc]; ok {
+		return
+	}
+	infos.pending = append(infos.pending, info)
+	infos.pendingIndex[info.Loc] = info
+}
+
+// Len returns the count of the infos, excluding the pending ones.
+func (infos ResourceOperationInfos) Len() int {
+	return len(infos.infos)
+}
+
+// All returns the infos in the insertion order, excluding the pending ones.
+func (infos ResourceOperationInfos) All() []*ResourceOperationInfo {
+	return infos.infos
+}
+
+// Pending returns the pending infos in the planned order.
+func (infos ResourceOperationInfos) Pending() []*ResourceOperationInfo {
+	var out []*ResourceOperationInfo
+	for _, info := range infos.pending {
+		if infos.pendingIndex[info.Loc] == info {
+			out = append(out, info)
 		}
 	}
-	return nil
+	return out
+}
+
+func (infos ResourceOperationInfos) Find(loc ResourceOperationInfoLocator) *ResourceOperationInfo {
+	return infos.index[loc]
+}
+
+// FindLatest returns the latest info of the resource by its absolute address (e.g. "module.m.null_resource.a"),
+// regardless of the action. This is used for the messages that don't tell the action, e.g. the provisioner hooks
+// and the diagnostics.
+func (infos ResourceOperationInfos) FindLatest(addr string) *ResourceOperationInfo {
+	return infos.latest[addr]
 }
 
 func (infos ResourceOperationInfos) Update(loc ResourceOperationInfoLocator, update ResourceOperationInfoUpdate) *ResourceOperationInfo {
@@ -83,31 +228,98 @@ func (infos ResourceOperationInfos) Update(loc ResourceOperationInfoLocator, upd
 	return info
 }
 
-// ToRows turns the ResourceInfos into table rows.
+// Overdue returns the infos whose operation is running well past its expected duration.
+func (infos ResourceOperationInfos) Overdue(now time.Time) []*ResourceOperationInfo {
+	return infos.filter(func(info *ResourceOperationInfo) bool {
+		return info.Overdue(now)
+	})
+}
+
+// Running returns the infos whose operation is still in progress, including the ones running provisioners.
+func (infos ResourceOperationInfos) Running() []*ResourceOperationInfo {
+	return infos.filter(func(info *ResourceOperationInfo) bool {
+		return info.Status == ResourceOperationStatusStart || info.Status == ResourceOperationStatusProvisioning
+	})
+}
+
+// Errored returns the infos whose operation has errored.
+func (infos ResourceOperationInfos) Errored() []*ResourceOperationInfo {
+	return infos.filter(func(info *ResourceOperationInfo) bool {
+		return info.Status == ResourceOperationStatusErrored
+	})
+}
+
+// ByModule returns the infos of the resources in the module. The root module is represented by an empty string.
+func (infos ResourceOperationInfos) ByModule(module string) []*ResourceOperationInfo {
+	return infos.filter(func(info *ResourceOperationInfo) bool {
+		return info.Loc.Module == module
+	})
+}
+
+// ByProvider returns the infos of the resources whose implied provider is the provider (e.g. "azurerm").
+func (infos ResourceOperationInfos) ByProvider(provider string) []*ResourceOperationInfo {
+	return infos.filter(func(info *ResourceOperationInfo) bool {
+		return info.RawResourceAddr.ImpliedProvider == provider
+	})
+}
+
+func (infos ResourceOperationInfos) filter(f func(*ResourceOperationInfo) bool) []*ResourceOperationInfo {
+	var out []*ResourceOperationInfo
+	for _, info := range infos.infos {
+		if f(info) {
+			out = append(out, info)
+		}
+	}
+	return out
+}
+
+// ToRows turns the ResourceInfos into table rows, the duration of the in-progress operations are calculated against now.
 // The total is used to decorate the index as a fraction, if total > 0.
-func (infos ResourceOperationInfos) ToRows(total int) []table.Row {
-	now := time.Now()
+// The pending infos are listed after the others, without the index and the duration.
+// The expected duration, if any, is shown next to the actual one.
+func (infos ResourceOperationInfos) ToRows(total int, now time.Time) []table.Row {
 	var rows []table.Row
-	for _, info := range infos {
+	for _, info := range slices.Concat(infos.All(), infos.Pending()) {
 		idx := strconv.Itoa(info.Idx)
 		if total > 0 {
 			idx = fmt.Sprintf("%d/%d", info.Idx, total)
 		}
 
-		dur := info.Duration(now)
+		dur := info.Duration(now).String()
+
+		if info.Status == ResourceOperationStatusPending {
+			idx = "-"
+			dur = ""
+		}
+		if info.Expected != nil {
+			dur = strings.TrimSpace(fmt.Sprintf("%s ~%s", dur, info.Expected.Median))
+		}
+
+		status := resourceOperationStatusEmoji(info.Status)
+		if info.Overdue(now) {
+			status = overdueEmoji
+		}
 
 		module := "-"
 		if info.Loc.Module != "" {
 			module = info.Loc.Module
 		}
 
+		// The provisioner sub-status
+		resource := info.Loc.ResourceAddr
+		if p := info.RunningProvisioner(); p != nil {
+			resource += fmt.Sprintf(" [%s]", p.Provisioner)
+		} else if info.HasErroredProvisioner() {
+			resource += " [provisioner errored]"
+		}
+
 		row := []string{
 			idx,
-			resourceOperationStatusEmoji(info.Status),
+			status,
 			string(info.Loc.Action),
 			module,
-			info.Loc.ResourceAddr,
-			dur.String(),
+			resource,
+			dur,
 		}
 		rows = append(rows, row)
 	}
@@ -135,10 +347,10 @@ func (infos ResourceOperationInfos) ToColumns(width int) []table.Column {
 	}
 }
 
-func (infos ResourceOperationInfos) ToCsv(stage string) []string {
-	var out []string
-	now := time.Now()
-	for _, info := range infos {
+// ToCsv turns the infos into csv records, each provisioner step of an info is a record of its own.
+func (infos ResourceOperationInfos) ToCsv(stage string, now time.Time) [][]string {
+	var out [][]string
+	for _, info := range infos.infos {
 		key, _ := info.RawResourceAddr.ResourceKey.MarshalJSON()
 		line := []string{
 			strconv.FormatInt(info.StartTime.Unix(), 10),
@@ -152,7 +364,24 @@ func (infos ResourceOperationInfos) ToCsv(stage string) []string {
 			string(info.Status),
 			strconv.FormatInt(int64(info.Duration(now).Seconds()), 10),
 		}
-		out = append(out, strings.Join(line, ","))
+		out = append(out, line)
+
+		// Each provisioner step has its own line, whose action is the provisioner type.
+		for _, p := range info.Provisioners {
+			line := []string{
+				strconv.FormatInt(p.StartTime.Unix(), 10),
+				strconv.FormatInt(p.EndTime.Unix(), 10),
+				"provision",
+				p.Provisioner,
+				info.Loc.Module,
+				info.RawResourceAddr.ResourceType,
+				info.RawResourceAddr.ResourceName,
+				string(key),
+				string(p.Status),
+				strconv.FormatInt(int64(p.Duration(now).Seconds()), 10),
+			}
+			out = append(out, line)
+		}
 	}
 	return out
 }
@@ -0,0 +1,111 @@
+package state_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/magodo/pipeform/internal/state"
+	"github.com/magodo/pipeform/terraform/views/json"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResourceOperationInfos(t *testing.T) {
+	var infos state.ResourceOperationInfos
+
+	newInfo := func(module, provider, addr string) *state.ResourceOperationInfo {
+		return &state.ResourceOperationInfo{
+			Idx: infos.Len() + 1,
+			RawResourceAddr: json.ResourceAddr{
+				Addr:            addr,
+				Module:          module,
+				ImpliedProvider: provider,
+			},
+			Loc: state.ResourceOperationInfoLocator{
+				Module:       module,
+				ResourceAddr: addr,
+				Action:       "create",
+			},
+			Status: state.ResourceOperationStatusStart,
+		}
+	}
+
+	for i := 0; i < 3; i++ {
+		infos.Add(newInfo("", "null", fmt.Sprintf("null_resource.r[%d]", i)))
+	}
+	infos.Add(newInfo("module.m", "random", "module.m.random_pet.p"))
+
+	require.Equal(t, 4, infos.Len())
+	for i, info := range infos.All() {
+		require.Equal(t, i+1, info.Idx)
+	}
+
+	loc := state.ResourceOperationInfoLocator{ResourceAddr: "null_resource.r[1]", Action: "create"}
+	require.Equal(t, 2, infos.Find(loc).Idx)
+	require.Nil(t, infos.Find(state.ResourceOperationInfoLocator{ResourceAddr: "null_resource.r[1]", Action: "delete"}))
+
+	status := state.ResourceOperationStatusErrored
+	endTime := time.Now()
+	info := infos.Update(loc, state.ResourceOperationInfoUpdate{Status: &status, Endtime: &endTime})
+	require.NotNil(t, info)
+	require.Equal(t, endTime, info.EndTime)
+
+	require.Len(t, infos.Running(), 3)
+	require.Equal(t, []*state.ResourceOperationInfo{info}, infos.Errored())
+	require.Len(t, infos.ByModule(""), 3)
+	require.Len(t, infos.ByModule("module.m"), 1)
+	require.Len(t, infos.ByProvider("random"), 1)
+}
+
+func TestResourceOperationInfosPending(t *testing.T) {
+	var infos state.ResourceOperationInfos
+
+	loc := func(addr, action string) state.ResourceOperationInfoLocator {
+		return state.ResourceOperationInfoLocator{ResourceAddr: addr, Action: action}
+	}
+	for _, l := range []state.ResourceOperationInfoLocator{loc("a", "delete"), loc("a", "create"), loc("b", "create"), loc("b", "create")} {
+		infos.AddPending(&state.ResourceOperationInfo{Loc: l, Status: state.ResourceOperationStatusPending})
+	}
+	require.Len(t, infos.Pending(), 3)
+	require.Equal(t, 0, infos.Len())
+
+	infos.Add(&state.ResourceOperationInfo{Idx: 1, Loc: loc("b", "create"), Status: state.ResourceOperationStatusStart})
+	require.Equal(t, 1, infos.Len())
+	require.Len(t, infos.Pending(), 2)
+	require.Nil(t, infos.Find(loc("a", "delete")))
+
+	// The started ones are listed first, then the pending ones without the index and the duration
+	rows := infos.ToRows(3, time.Time{})
+	require.Len(t, rows, 3)
+	require.Equal(t, "1/3", rows[0][0])
+	require.Equal(t, "b", rows[0][4])
+	require.Equal(t, []string{"-", "⏳", "delete", "-", "a", ""}, []string(rows[1]))
+	require.Equal(t, []string{"-", "⏳", "create", "-", "a", ""}, []string(rows[2]))
+}
+
+func TestResourceOperationInfoOverdue(t *testing.T) {
+	start := time.Date(2025, 1, 10, 10, 0, 0, 0, time.UTC)
+	info := state.ResourceOperationInfo{
+		Status:    state.ResourceOperationStatusStart,
+		StartTime: start,
+	}
+	// No history
+	require.False(t, info.Overdue(start.Add(time.Hour)))
+
+	info.Expected = &state.ExpectedDuration{Median: 10 * time.Second, P90: 20 * time.Second}
+	require.False(t, info.Overdue(start.Add(20*time.Second)))
+	// Within the slack
+	require.False(t, info.Overdue(start.Add(30*time.Second)))
+	require.True(t, info.Overdue(start.Add(31*time.Second)))
+
+	var infos state.ResourceOperationInfos
+	infos.Add(&info)
+	require.Len(t, infos.Overdue(start.Add(time.Minute)), 1)
+	require.Equal(t, "🐢", infos.ToRows(0, start.Add(time.Minute))[0][1])
+	require.Equal(t, "1m0s ~10s", infos.ToRows(0, start.Add(time.Minute))[0][5])
+
+	// A finished operation is never overdue
+	info.Status = state.ResourceOperationStatusComplete
+	info.EndTime = start.Add(time.Minute)
+	require.False(t, info.Overdue(start.Add(time.Hour)))
+}
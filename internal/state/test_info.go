@@ -0,0 +1,226 @@
+package state
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/charmbracelet/bubbles/table"
+	"github.com/magodo/pipeform/terraform/views/json"
+)
+
+// TestInfo records the status of a test file, or a run block of a test file.
+type TestInfo struct {
+	File string
+	// Run is empty for the test file itself
+	Run string
+
+	Progress  json.TestProgress
+	Status    json.TestStatus
+	StartTime time.Time
+	EndTime   time.Time
+	// Elapsed is the elapsed time reported by Terraform for a run block, if any. It is more precise than the
+	// timestamps of the messages, which are truncated to the second.
+	Elapsed *time.Duration
+}
+
+func (info TestInfo) IsFile() bool {
+	return info.Run == ""
+}
+
+// Duration returns the elapsed time reported by Terraform once the run block completes, or the one derived from
+// the timestamps otherwise.
+func (info TestInfo) Duration(now time.Time) time.Duration {
+	if !info.EndTime.Equal(time.Time{}) && info.Elapsed != nil {
+		return *info.Elapsed
+	}
+	if info.StartTime.Equal(time.Time{}) {
+		return 0
+	}
+	if info.EndTime.Equal(time.Time{}) {
+		return now.Sub(info.StartTime).Truncate(time.Second)
+	}
+	return info.EndTime.Sub(info.StartTime).Truncate(time.Second)
+}
+
+func testStatusEmoji(info TestInfo) string {
+	switch info.Status {
+	case json.TestPass:
+		return "✅"
+	case json.TestFail:
+		return "❌"
+	case json.TestError:
+		return "💥"
+	case json.TestSkip:
+		return "⏭️"
+	}
+	if info.Progress == "" {
+		return "⏳"
+	}
+	return "🕛"
+}
+
+// TestInfos records the test files and their run blocks, the run blocks follow their owning file.
+type TestInfos []*TestInfo
+
+// NewTestInfos creates the TestInfos in pending status from the test abstract.
+func NewTestInfos(abstract json.TestSuiteAbstract) TestInfos {
+	var files []string
+	for file := range abstract {
+		files = append(files, file)
+	}
+	sort.Strings(files)
+
+	var infos TestInfos
+	for _, file := range files {
+		infos = append(infos, &TestInfo{File: file, Status: json.TestPending})
+		for _, run := range abstract[file] {
+			infos = append(infos, &TestInfo{File: file, Run: run, Status: json.TestPending})
+		}
+	}
+	return infos
+}
+
+func (infos TestInfos) Find(file, run string) *TestInfo {
+	for _, info := range infos {
+		if info.File == file && info.Run == run {
+			return info
+		}
+	}
+	return nil
+}
+
+// Upsert updates the test info identified by the file and run with the progress, status and the elapsed
+// milliseconds (if any). The test info will be created if not exist, e.g. when there is no test abstract sent.
+func (infos *TestInfos) Upsert(file, run string, progress json.TestProgress, status json.TestStatus, elapsed *int64, timestamp time.Time) *TestInfo {
+	info := infos.Find(file, run)
+	if info == nil {
+		info = &TestInfo{File: file, Run: run}
+		*infos = append(*infos, info)
+	}
+	if info.StartTime.Equal(time.Time{}) {
+		info.StartTime = timestamp
+	}
+	info.Progress = progress
+	if status != "" {
+		info.Status = status
+	}
+	// Only the elapsed time of the latest message is kept, e.g. the one of the starting message is always 0.
+	info.Elapsed = nil
+	if elapsed != nil {
+		d := time.Duration(*elapsed) * time.Millisecond
+		info.Elapsed = &d
+	}
+	if progress == json.TestComplete {
+		info.EndTime = timestamp
+	}
+	return info
+}
+
+// RunCount returns the count of the run blocks, and the count of the ones that have completed.
+func (infos TestInfos) RunCount() (total, done int) {
+	for _, info := range infos {
+		if info.IsFile() {
+			continue
+		}
+		total++
+		if info.Progress == json.TestComplete || info.Status == json.TestSkip {
+			done++
+		}
+	}
+	return
+}
+
+// RunIndex returns the 1-based index of the run block among all the run blocks.
+func (infos TestInfos) RunIndex(file, run string) int {
+	var idx int
+	for _, info := range infos {
+		if info.IsFile() {
+			continue
+		}
+		idx++
+		if info.File == file && info.Run == run {
+			return idx
+		}
+	}
+	return 0
+}
+
+func (infos TestInfos) ToRows(now time.Time) []table.Row {
+	total, _ := infos.RunCount()
+
+	var rows []table.Row
+	var idx int
+	for _, info := range infos {
+		var index, run string
+		if info.IsFile() {
+			index = "-"
+			run = "-"
+		} else {
+			idx++
+			index = fmt.Sprintf("%d/%d", idx, total)
+			run = info.Run
+		}
+
+		dur := "-"
+		if !info.StartTime.Equal(time.Time{}) {
+			dur = info.Duration(now).String()
+		}
+
+		row := []string{
+			index,
+			testStatusEmoji(*info),
+			info.File,
+			run,
+			dur,
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+func (infos TestInfos) ToColumns(width int) []table.Column {
+	const indexWidth = 10
+	const statusWidth = 6
+	const timeWidth = 24
+
+	dynamicWidth := width - indexWidth - statusWidth - timeWidth
+
+	fileWidth := dynamicWidth / 2
+	runWidth := dynamicWidth / 2
+
+	return []table.Column{
+		{Title: "Index", Width: indexWidth},
+		{Title: "Status", Width: statusWidth},
+		{Title: "File", Width: fileWidth},
+		{Title: "Run", Width: runWidth},
+		{Title: "Time", Width: timeWidth},
+	}
+}
+
+// ToCsv turns the test infos into csv records, aligned with the ResourceOperationInfos.ToCsv.
+// The test file is put in the "Module" column, and the run block in the "Resource Name" column.
+func (infos TestInfos) ToCsv(now time.Time) [][]string {
+	var out [][]string
+	for _, info := range infos {
+		action := "run"
+		if info.IsFile() {
+			action = "file"
+		}
+		line := []string{
+			strconv.FormatInt(info.StartTime.Unix(), 10),
+			strconv.FormatInt(info.EndTime.Unix(), 10),
+			"test",
+			action,
+			info.File,
+			"",
+			info.Run,
+			"",
+			string(info.Status),
+			strconv.FormatInt(int64(info.Duration(now).Seconds()), 10),
+		}
+		out = append(out, line)
+	}
+	return out
+}
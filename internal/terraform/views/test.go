@@ -1,4 +0,0 @@
-package views
-
-// This file define structures corresponding to the different logs defined in:
-// terraform/internal/command/views/test.go (TestJSON)
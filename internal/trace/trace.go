@@ -0,0 +1,271 @@
+// Package trace exports the timing of the run in the Chrome Trace Event format, which can be opened in
+// chrome://tracing or Perfetto.
+//
+// Each stage (i.e. refresh and apply) is a process, whose threads are the lanes of the modules. The operations of
+// a module that overlap are put on separate lanes of the module, as the events on the same thread must be nested.
+// Reference: https://docs.google.com/document/d/1CvAClvFfyA5R-PhYUmn5OOQtYMH4h6I0nSsKchNAySU
+package trace
+
+import (
+	gojson "encoding/json"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/magodo/pipeform/internal/engine"
+	"github.com/magodo/pipeform/internal/state"
+	"github.com/magodo/pipeform/terraform/views/json"
+)
+
+const (
+	phaseComplete = "X"
+	phaseInstant  = "i"
+	phaseMetadata = "M"
+
+	// scopeThread and scopeGlobal are the scopes of the instant events
+	scopeThread = "t"
+	scopeGlobal = "g"
+
+	// rootModule is the lane name of the root module
+	rootModule = "root"
+
+	// maxLanes is the maximum count of the lanes of a module, which is only used to sort the lanes
+	maxLanes = 10000
+)
+
+type event struct {
+	Name string         `json:"name"`
+	Cat  string         `json:"cat,omitempty"`
+	Ph   string         `json:"ph"`
+	Ts   int64          `json:"ts"`
+	Dur  *int64         `json:"dur,omitempty"`
+	Pid  int            `json:"pid"`
+	Tid  int            `json:"tid"`
+	S    string         `json:"s,omitempty"`
+	Args map[string]any `json:"args,omitempty"`
+}
+
+type trace struct {
+	TraceEvents     []event `json:"traceEvents"`
+	DisplayTimeUnit string  `json:"displayTimeUnit"`
+}
+
+// lane is a thread in the trace, where the events don't overlap.
+type lane struct {
+	tid int
+	end time.Time
+}
+
+type builder struct {
+	start time.Time
+	now   time.Time
+
+	events []event
+	// lanes are the lanes of each module in the current process, and modules are the modules in the order of
+	// their first operations, which decide the order of the lanes.
+	lanes   map[string][]*lane
+	modules []string
+	tidCnt  int
+	// tidOf is the tid of the lane of each operation
+	tidOf map[*state.ResourceOperationInfo]int
+	// end is the end time of the latest event
+	end time.Time
+}
+
+// JSON renders the trace of the run recorded by the engine. The now is used as the end of the in-progress
+// operations.
+func JSON(e *engine.Engine, now time.Time) ([]byte, error) {
+	b := &builder{
+		start: e.StartTime(),
+		now:   now,
+		tidOf: map[*state.ResourceOperationInfo]int{},
+	}
+	processes := []struct {
+		pid   int
+		stage engine.Stage
+		infos state.ResourceOperationInfos
+	}{
+		{pid: 1, stage: engine.StageRefresh, infos: e.RefreshInfos()},
+		{pid: 2, stage: engine.StageApply, infos: e.ApplyInfos()},
+	}
+	for _, p := range processes {
+		b.addProcess(p.pid, p.stage, p.infos)
+	}
+
+	// The diagnostics don't have the timestamps, the ones linked to an operation are placed at its end on its lane,
+	// others are placed at the end of the trace.
+	linked := map[json.Diagnostic]bool{}
+	for _, p := range processes {
+		for _, info := range p.infos.All() {
+			tid, ok := b.tidOf[info]
+			if !ok {
+				continue
+			}
+			for _, d := range info.Diags {
+				linked[d] = true
+				b.events = append(b.events, event{
+					Name: fmt.Sprintf("%s: %s", d.Severity, d.Summary),
+					Cat:  "diagnostic",
+					Ph:   phaseInstant,
+					Ts:   b.ts(b.endOf(info)),
+					Pid:  p.pid,
+					Tid:  tid,
+					S:    scopeThread,
+					Args: map[string]any{"detail": d.Detail, "address": d.Address},
+				})
+			}
+		}
+	}
+	for _, d := range e.Diags() {
+		if linked[d] {
+			continue
+		}
+		b.events = append(b.events, event{
+			Name: fmt.Sprintf("%s: %s", d.Severity, d.Summary),
+			Cat:  "diagnostic",
+			Ph:   phaseInstant,
+			Ts:   b.ts(b.end),
+			Pid:  1,
+			S:    scopeGlobal,
+			Args: map[string]any{"detail": d.Detail},
+		})
+	}
+
+	out, err := gojson.MarshalIndent(trace{TraceEvents: b.events, DisplayTimeUnit: "ms"}, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("marshal trace: %v", err)
+	}
+	return out, nil
+}
+
+// addProcess adds the operations of the stage as a process.
+func (b *builder) addProcess(pid int, stage engine.Stage, infos state.ResourceOperationInfos) {
+	if infos.Len() == 0 {
+		return
+	}
+	b.events = append(b.events, event{
+		Name: "process_name",
+		Ph:   phaseMetadata,
+		Pid:  pid,
+		Args: map[string]any{"name": string(stage)},
+	}, event{
+		Name: "process_sort_index",
+		Ph:   phaseMetadata,
+		Pid:  pid,
+		Args: map[string]any{"sort_index": pid},
+	})
+
+	b.lanes = map[string][]*lane{}
+	b.modules = nil
+	b.tidCnt = 0
+	for _, info := range infos.All() {
+		if info.StartTime.IsZero() {
+			continue
+		}
+		l := b.allocLane(pid, info)
+		b.tidOf[info] = l.tid
+
+		dur := b.ts(b.endOf(info)) - b.ts(info.StartTime)
+		b.events = append(b.events, event{
+			Name: fmt.Sprintf("%s %s", info.Loc.Action, info.Loc.ResourceAddr),
+			Cat:  string(stage),
+			Ph:   phaseComplete,
+			Ts:   b.ts(info.StartTime),
+			Dur:  &dur,
+			Pid:  pid,
+			Tid:  l.tid,
+			Args: map[string]any{
+				"module":        info.RawResourceAddr.Module,
+				"resource_type": info.RawResourceAddr.ResourceType,
+				"resource_name": info.RawResourceAddr.ResourceName,
+				"resource_key":  info.RawResourceAddr.ResourceKey,
+				"provider":      info.RawResourceAddr.ImpliedProvider,
+				"action":        info.Loc.Action,
+				"status":        string(info.Status),
+			},
+		})
+
+		// The provisioner steps run during the operation, which are nested in it.
+		for _, p := range info.Provisioners {
+			end := p.EndTime
+			if end.IsZero() {
+				end = b.now
+			}
+			dur := b.ts(end) - b.ts(p.StartTime)
+			b.events = append(b.events, event{
+				Name: p.Provisioner,
+				Cat:  "provision",
+				Ph:   phaseComplete,
+				Ts:   b.ts(p.StartTime),
+				Dur:  &dur,
+				Pid:  pid,
+				Tid:  l.tid,
+				Args: map[string]any{
+					"status": string(p.Status),
+					"output": p.Output,
+				},
+			})
+		}
+	}
+}
+
+// allocLane returns the first lane of the module of the operation, which is free at the start of the operation.
+// A new lane is added if all of them are busy.
+func (b *builder) allocLane(pid int, info *state.ResourceOperationInfo) *lane {
+	module := info.Loc.Module
+	if module == "" {
+		module = rootModule
+	}
+	end := b.endOf(info)
+	for _, l := range b.lanes[module] {
+		if !l.end.After(info.StartTime) {
+			l.end = end
+			return l
+		}
+	}
+
+	if _, ok := b.lanes[module]; !ok {
+		b.modules = append(b.modules, module)
+	}
+	b.tidCnt++
+	l := &lane{tid: b.tidCnt, end: end}
+	n := len(b.lanes[module])
+	name := module
+	if n != 0 {
+		name = fmt.Sprintf("%s #%d", module, n+1)
+	}
+	b.lanes[module] = append(b.lanes[module], l)
+
+	// The lanes of the same module are sorted together, though their tids might be interleaved.
+	sortIndex := slices.Index(b.modules, module)*maxLanes + n
+	b.events = append(b.events, event{
+		Name: "thread_name",
+		Ph:   phaseMetadata,
+		Pid:  pid,
+		Tid:  l.tid,
+		Args: map[string]any{"name": name},
+	}, event{
+		Name: "thread_sort_index",
+		Ph:   phaseMetadata,
+		Pid:  pid,
+		Tid:  l.tid,
+		Args: map[string]any{"sort_index": sortIndex},
+	})
+	return l
+}
+
+func (b *builder) endOf(info *state.ResourceOperationInfo) time.Time {
+	end := info.EndTime
+	if end.IsZero() {
+		end = b.now
+	}
+	if end.After(b.end) {
+		b.end = end
+	}
+	return end
+}
+
+// ts returns the timestamp in microseconds since the start of the run.
+func (b *builder) ts(t time.Time) int64 {
+	return t.Sub(b.start).Microseconds()
+}
@@ -0,0 +1,130 @@
+package trace_test
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/magodo/pipeform/internal/enginetest"
+	"github.com/magodo/pipeform/internal/trace"
+	"github.com/stretchr/testify/require"
+)
+
+type event struct {
+	Name string         `json:"name"`
+	Cat  string         `json:"cat"`
+	Ph   string         `json:"ph"`
+	Ts   int64          `json:"ts"`
+	Dur  int64          `json:"dur"`
+	Pid  int            `json:"pid"`
+	Tid  int            `json:"tid"`
+	S    string         `json:"s"`
+	Args map[string]any `json:"args"`
+}
+
+func traceEvents(t *testing.T, name string) []event {
+	e, _ := enginetest.Apply(t, name)
+
+	b, err := trace.JSON(e, time.Date(2025, 1, 10, 10, 0, 20, 0, time.UTC))
+	require.NoError(t, err)
+
+	var out struct {
+		TraceEvents     []event `json:"traceEvents"`
+		DisplayTimeUnit string  `json:"displayTimeUnit"`
+	}
+	require.NoError(t, json.Unmarshal(b, &out))
+	require.Equal(t, "ms", out.DisplayTimeUnit)
+	return out.TraceEvents
+}
+
+// find returns the events of the phase with the name
+func find(events []event, ph, name string) []event {
+	var out []event
+	for _, ev := range events {
+		if ev.Ph == ph && ev.Name == name {
+			out = append(out, ev)
+		}
+	}
+	return out
+}
+
+func TestJSON(t *testing.T) {
+	events := traceEvents(t, "apply.jsonl")
+
+	// The stages are the processes
+	procs := map[int]string{}
+	for _, ev := range find(events, "M", "process_name") {
+		procs[ev.Pid] = ev.Args["name"].(string)
+	}
+	require.Equal(t, map[int]string{1: "refresh", 2: "apply"}, procs)
+
+	// The modules are the lanes, where the overlapping operations are on separate lanes
+	lanes := map[int]string{}
+	for _, ev := range find(events, "M", "thread_name") {
+		if ev.Pid == 2 {
+			lanes[ev.Tid] = ev.Args["name"].(string)
+		}
+	}
+	require.Equal(t, map[int]string{1: "root", 2: "root #2", 3: "module.m"}, lanes)
+
+	refresh := find(events, "X", "refresh random_pet.dog")
+	require.Len(t, refresh, 1)
+	require.Equal(t, event{
+		Name: "refresh random_pet.dog",
+		Cat:  "refresh",
+		Ph:   "X",
+		Ts:   1000000,
+		Dur:  1000000,
+		Pid:  1,
+		Tid:  1,
+		Args: map[string]any{
+			"module":        "",
+			"resource_type": "random_pet",
+			"resource_name": "dog",
+			"resource_key":  nil,
+			"provider":      "random",
+			"action":        "refresh",
+			"status":        "complete",
+		},
+	}, refresh[0])
+
+	// The replacement reuses the lane after the deletion
+	deletion := find(events, "X", "delete random_pet.dog")
+	require.Len(t, deletion, 1)
+	creation := find(events, "X", "create random_pet.dog")
+	require.Len(t, creation, 1)
+	require.Equal(t, deletion[0].Tid, creation[0].Tid)
+	require.GreaterOrEqual(t, creation[0].Ts, deletion[0].Ts+deletion[0].Dur)
+
+	// The diagnostic is at the end of the operation it links to, on the same lane
+	bad := find(events, "X", "create module.m.null_resource.bad")
+	require.Len(t, bad, 1)
+	require.Equal(t, "error", bad[0].Args["status"])
+	diags := find(events, "i", "error: local-exec provisioner error")
+	require.Len(t, diags, 1)
+	require.Equal(t, "t", diags[0].S)
+	require.Equal(t, bad[0].Tid, diags[0].Tid)
+	require.Equal(t, bad[0].Ts+bad[0].Dur, diags[0].Ts)
+}
+
+func TestJSONProvision(t *testing.T) {
+	events := traceEvents(t, "provision.jsonl")
+
+	// The provisioner steps are nested in their operations
+	for _, name := range []string{"create null_resource.ok", "create null_resource.bad"} {
+		ops := find(events, "X", name)
+		require.Len(t, ops, 1)
+		op := ops[0]
+
+		var nested []event
+		for _, ev := range find(events, "X", "local-exec") {
+			if ev.Tid == op.Tid {
+				nested = append(nested, ev)
+			}
+		}
+		require.Len(t, nested, 1)
+		require.Equal(t, "provision", nested[0].Cat)
+		require.GreaterOrEqual(t, nested[0].Ts, op.Ts)
+		require.LessOrEqual(t, nested[0].Ts+nested[0].Dur, op.Ts+op.Dur)
+	}
+}
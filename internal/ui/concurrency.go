@@ -0,0 +1,20 @@
+package ui
+
+import (
+	"strings"
+
+	"github.com/magodo/pipeform/internal/concurrency"
+)
+
+// concurrencyContent renders the concurrency analysis of the apply operations.
+func concurrencyContent(a concurrency.Analysis) string {
+	lines := a.Lines()
+	if len(lines) == 0 {
+		return StyleComment.Render("No apply operation")
+	}
+	lines[0] = StyleSubtitle.Render(" " + lines[0] + " ")
+	if a.ParallelismLimited() {
+		lines[len(lines)-1] = StyleWarning.Render(lines[len(lines)-1])
+	}
+	return strings.Join(lines, "\n")
+}
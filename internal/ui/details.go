@@ -0,0 +1,71 @@
+package ui
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/magodo/pipeform/internal/diag"
+	"github.com/magodo/pipeform/internal/state"
+)
+
+// detailsContent renders the details of a resource operation, including the summaries of its diagnostics and
+// the outputs of its provisioners.
+func detailsContent(info *state.ResourceOperationInfo, now time.Time) string {
+	if info == nil {
+		return StyleComment.Render("No resource operation selected. Select one in the REFRESH or APPLY table, then press the key again.")
+	}
+
+	var lines []string
+
+	addr := info.Loc.ResourceAddr
+	lines = append(lines, fmt.Sprintf("%s (%s)", StyleSubtitle.Render(" "+addr+" "), info.Loc.Action))
+	if info.Status == state.ResourceOperationStatusPending {
+		lines = append(lines, fmt.Sprintf("Status: %s", info.Status))
+	} else {
+		lines = append(lines, fmt.Sprintf("Status: %s    Time: %s", info.Status, info.Duration(now)))
+	}
+	if exp := info.Expected; exp != nil {
+		expected := fmt.Sprintf("Expected: ~%s (p90: %s)", exp.Median, exp.P90)
+		if info.Overdue(now) {
+			expected = StyleWarning.Render(expected + " overdue, the provider might hang")
+		}
+		lines = append(lines, expected)
+	}
+
+	if len(info.Diags) != 0 {
+		lines = append(lines, "")
+		for _, d := range info.Diags {
+			lines = append(lines, diag.Summary(d, diag.WithColor(true)))
+		}
+		lines = append(lines, StyleComment.Render("Press enter in the table to view the full diagnostics."))
+	}
+
+	if len(info.Provisioners) == 0 {
+		lines = append(lines, "", StyleComment.Render("No provisioner"))
+		return strings.Join(lines, "\n")
+	}
+
+	for _, p := range info.Provisioners {
+		header := fmt.Sprintf("%s %s (%s)", provisionerStatusEmoji(p.Status), p.Provisioner, p.Duration(now))
+		if p.Status == state.ResourceOperationStatusErrored {
+			header = StyleErrorMsg.Render(header + " errored")
+		}
+		lines = append(lines, "", header)
+		for _, output := range p.Output {
+			lines = append(lines, "    "+output)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+func provisionerStatusEmoji(status state.ResourceOperationStatus) string {
+	switch status {
+	case state.ResourceOperationStatusComplete:
+		return "✅"
+	case state.ResourceOperationStatusErrored:
+		return "❌"
+	default:
+		return "🕛"
+	}
+}
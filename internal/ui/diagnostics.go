@@ -0,0 +1,32 @@
+package ui
+
+import (
+	"strings"
+
+	"github.com/magodo/pipeform/internal/diag"
+	"github.com/magodo/pipeform/internal/engine"
+	"github.com/magodo/pipeform/terraform/views/json"
+)
+
+// diagnosticsContent renders the diagnostics in the way similar to Terraform's human readable output.
+// The details are wrapped to fit in the width, unless it is zero.
+func diagnosticsContent(diags engine.Diags, width int) string {
+	if len(diags) == 0 {
+		return StyleComment.Render("No diagnostics")
+	}
+	return diag.RenderAll(diags, diag.WithWidth(width), diag.WithColor(true))
+}
+
+// diagnosticOffset returns the line offset of the first diagnostic that equals to the target in the content
+// rendered by diagnosticsContent, and whether it is found.
+func diagnosticOffset(diags engine.Diags, target json.Diagnostic, width int) (int, bool) {
+	var offset int
+	for _, d := range diags {
+		if d == target {
+			return offset, true
+		}
+		// The block lines, plus the blank line in between
+		offset += strings.Count(diag.Render(d, diag.WithWidth(width), diag.WithColor(true)), "\n") + 2
+	}
+	return 0, false
+}
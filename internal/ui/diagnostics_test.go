@@ -0,0 +1,27 @@
+package ui
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/magodo/pipeform/internal/engine"
+	"github.com/magodo/pipeform/terraform/views/json"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiagnosticOffset(t *testing.T) {
+	diags := engine.Diags{
+		{Severity: json.DiagnosticSeverityWarning, Summary: "first"},
+		{Severity: json.DiagnosticSeverityError, Summary: "second", Detail: "some detail"},
+		{Severity: json.DiagnosticSeverityError, Summary: "third"},
+	}
+
+	offset, ok := diagnosticOffset(diags, diags[2], 0)
+	require.True(t, ok)
+	lines := strings.Split(diagnosticsContent(diags, 0), "\n")
+	require.Equal(t, "╷", lines[offset])
+	require.Equal(t, "│ Error: third", lines[offset+1])
+
+	_, ok = diagnosticOffset(diags, json.Diagnostic{Summary: "unknown"}, 0)
+	require.False(t, ok)
+}
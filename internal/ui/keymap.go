@@ -14,6 +14,24 @@ type KeyMap struct {
 	Quit   key.Binding
 	Copy   key.Binding
 
+	RawLines    key.Binding
+	Details     key.Binding
+	Diagnostics key.Binding
+	JumpToDiag  key.Binding
+	Aux         key.Binding
+	Concurrency key.Binding
+	Timeline    key.Binding
+
+	// Only for the timeline page
+	ZoomIn      key.Binding
+	ZoomOut     key.Binding
+	ScrollLeft  key.Binding
+	ScrollRight key.Binding
+
+	// Only for replay
+	Pause     key.Binding
+	NextPhase key.Binding
+
 	Help key.Binding
 }
 
@@ -21,14 +39,14 @@ type KeyMap struct {
 // of the key.Map interface.
 func (k KeyMap) ShortHelp() []key.Binding {
 	tableHelp := k.TableKeyMap.ShortHelp()
-	return append([]key.Binding{k.Follow, k.Quit, k.Copy, k.PaginatorMap.PrevPage, k.PaginatorMap.NextPage, k.Help}, tableHelp...)
+	return append([]key.Binding{k.Follow, k.Quit, k.Copy, k.RawLines, k.Details, k.Diagnostics, k.JumpToDiag, k.Aux, k.Concurrency, k.Timeline, k.ZoomIn, k.ZoomOut, k.ScrollLeft, k.ScrollRight, k.Pause, k.NextPhase, k.PaginatorMap.PrevPage, k.PaginatorMap.NextPage, k.Help}, tableHelp...)
 }
 
 // FullHelp returns keybindings for the expanded help view. It's part of the
 // key.Map interface.
 func (k KeyMap) FullHelp() [][]key.Binding {
 	tableHelp := k.TableKeyMap.FullHelp()
-	return append([][]key.Binding{{k.Follow, k.Quit, k.Copy, k.Help, k.PaginatorMap.PrevPage, k.PaginatorMap.NextPage}}, tableHelp...)
+	return append([][]key.Binding{{k.Follow, k.Quit, k.Copy, k.Help, k.PaginatorMap.PrevPage, k.PaginatorMap.NextPage}, {k.RawLines, k.Details, k.Diagnostics, k.JumpToDiag, k.Aux, k.Concurrency, k.Timeline, k.Pause, k.NextPhase}, {k.ZoomIn, k.ZoomOut, k.ScrollLeft, k.ScrollRight}}, tableHelp...)
 }
 
 func NewKeyMap(clipboardEnabled bool) KeyMap {
@@ -50,10 +68,68 @@ func NewKeyMap(clipboardEnabled bool) KeyMap {
 			key.WithKeys("c"),
 			key.WithHelp("c", "copy"),
 		),
+		RawLines: key.NewBinding(
+			key.WithKeys("r"),
+			key.WithHelp("r", "raw lines"),
+		),
+		Details: key.NewBinding(
+			key.WithKeys("o"),
+			key.WithHelp("o", "details"),
+		),
+		Diagnostics: key.NewBinding(
+			key.WithKeys("e"),
+			key.WithHelp("e", "diagnostics"),
+		),
+		JumpToDiag: key.NewBinding(
+			key.WithKeys("enter"),
+			key.WithHelp("enter", "jump to diagnostic"),
+		),
+		Aux: key.NewBinding(
+			key.WithKeys("a"),
+			key.WithHelp("a", "read/ephemeral"),
+		),
+		Concurrency: key.NewBinding(
+			key.WithKeys("i"),
+			key.WithHelp("i", "concurrency"),
+		),
+		Timeline: key.NewBinding(
+			key.WithKeys("t"),
+			key.WithHelp("t", "timeline"),
+		),
+		ZoomIn: key.NewBinding(
+			key.WithKeys("+", "="),
+			key.WithHelp("+", "zoom in"),
+			key.WithDisabled(),
+		),
+		ZoomOut: key.NewBinding(
+			key.WithKeys("-"),
+			key.WithHelp("-", "zoom out"),
+			key.WithDisabled(),
+		),
+		ScrollLeft: key.NewBinding(
+			key.WithKeys("<", ","),
+			key.WithHelp("<", "scroll left"),
+			key.WithDisabled(),
+		),
+		ScrollRight: key.NewBinding(
+			key.WithKeys(">", "."),
+			key.WithHelp(">", "scroll right"),
+			key.WithDisabled(),
+		),
 		Help: key.NewBinding(
 			key.WithKeys("?"),
 			key.WithHelp("?", "toggle help"),
 		),
+		Pause: key.NewBinding(
+			key.WithKeys("p"),
+			key.WithHelp("p", "pause/resume"),
+			key.WithDisabled(),
+		),
+		NextPhase: key.NewBinding(
+			key.WithKeys("n"),
+			key.WithHelp("n", "next phase"),
+			key.WithDisabled(),
+		),
 	}
 
 	if !clipboardEnabled {
@@ -67,3 +143,15 @@ func (km *KeyMap) EnablePaginator() {
 	km.PaginatorMap.PrevPage.SetEnabled(true)
 	km.PaginatorMap.NextPage.SetEnabled(true)
 }
+
+func (km *KeyMap) EnablePlayer(enabled bool) {
+	km.Pause.SetEnabled(enabled)
+	km.NextPhase.SetEnabled(enabled)
+}
+
+func (km *KeyMap) EnableTimeline(enabled bool) {
+	km.ZoomIn.SetEnabled(enabled)
+	km.ZoomOut.SetEnabled(enabled)
+	km.ScrollLeft.SetEnabled(enabled)
+	km.ScrollRight.SetEnabled(enabled)
+}
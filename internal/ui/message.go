@@ -1,17 +1,10 @@
 package ui
 
-import "github.com/magodo/pipeform/internal/terraform/views"
+import "github.com/magodo/pipeform/terraform/views"
 
-type receiverMsg struct {
-	msg views.Message
-}
-
-type receiverEOFMsg struct{}
-
-type receiverErrorMsg struct {
-	err error
-}
-
-func (m receiverErrorMsg) Error() string {
-	return m.err.Error()
+// receiverBatchMsg carries the messages that have been read since the last batch.
+// The err (e.g. io.EOF) is the error met after reading these messages, if any.
+type receiverBatchMsg struct {
+	msgs []views.Message
+	err  error
 }
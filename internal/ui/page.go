@@ -0,0 +1,37 @@
+package ui
+
+// Page is what to display in the main area. Other than the table of the current view state,
+// users can toggle to a dedicated page at any time.
+type Page int
+
+const (
+	PageTable Page = iota
+	PageRawLines
+	PageDetails
+	PageDiagnostics
+	// PageAux is rendered with the table as well, for the operations of the aux stage.
+	PageAux
+	PageConcurrency
+	PageTimeline
+)
+
+func (p Page) String() string {
+	switch p {
+	case PageTable:
+		return "TABLE"
+	case PageRawLines:
+		return "RAW LINES"
+	case PageDetails:
+		return "DETAILS"
+	case PageDiagnostics:
+		return "DIAGNOSTICS"
+	case PageAux:
+		return "READ/EPHEMERAL"
+	case PageConcurrency:
+		return "CONCURRENCY"
+	case PageTimeline:
+		return "TIMELINE"
+	default:
+		return "UNKNOWN"
+	}
+}
@@ -23,6 +23,7 @@ var (
 	StyleTitle    = lipgloss.NewStyle().Foreground(ColorCream).Background(ColorIndigo)
 	StyleSubtitle = lipgloss.NewStyle().Foreground(ColorCream).Background(ColorSubtleIndigo)
 	StyleComment  = lipgloss.NewStyle().Foreground(ColorGrey)
+	StyleWarning  = lipgloss.NewStyle().Foreground(ColorFuschia)
 
 	StyleTableFunc = func() table.Styles {
 		s := table.DefaultStyles()
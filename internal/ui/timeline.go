@@ -0,0 +1,173 @@
+package ui
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/magodo/pipeform/internal/concurrency"
+	"github.com/magodo/pipeform/internal/state"
+	"github.com/muesli/reflow/truncate"
+)
+
+const (
+	// timelineMaxZoom is the maximum zoom level, where each level doubles the scale
+	timelineMaxZoom = 6
+	// timelineScrollStep is the count of the columns to scroll at a time
+	timelineScrollStep = 10
+	// timelineTickStep is the count of the columns between the ticks of the time axis
+	timelineTickStep = 20
+)
+
+var (
+	styleBarComplete = lipgloss.NewStyle().Foreground(ColorGreen)
+	styleBarErrored  = lipgloss.NewStyle().Foreground(ColorRed)
+	styleBarRunning  = lipgloss.NewStyle().Foreground(ColorIndigo)
+	styleBarOverdue  = lipgloss.NewStyle().Foreground(ColorFuschia)
+)
+
+// Timeline is the zoom and the horizontal scroll of the timeline page.
+type Timeline struct {
+	// Zoom is the zoom level, where 0 fits the whole run in the width
+	Zoom int
+	// Offset is the count of the columns scrolled to the right
+	Offset int
+
+	// critical caches the operations on the critical path, which is reset once the operations change, or as the
+	// in-progress ones grow.
+	critical map[*state.ResourceOperationInfo]bool
+}
+
+// Reset resets the cached critical path, which is recalculated on the next rendering.
+func (t *Timeline) Reset() {
+	t.critical = nil
+}
+
+func (t *Timeline) ZoomIn() {
+	if t.Zoom < timelineMaxZoom {
+		t.Zoom++
+		// Keep the left edge at the same time
+		t.Offset *= 2
+	}
+}
+
+func (t *Timeline) ZoomOut() {
+	if t.Zoom > 0 {
+		t.Zoom--
+		t.Offset /= 2
+	}
+}
+
+func (t *Timeline) ScrollLeft() {
+	t.Offset = max(t.Offset-timelineScrollStep, 0)
+}
+
+func (t *Timeline) ScrollRight() {
+	// The upper bound depends on the width, which is clamped during rendering.
+	t.Offset += timelineScrollStep
+}
+
+// timelineContent renders each of the operations as a horizontal bar along the time, colored by its status.
+// The operations on the critical path are marked with a star, which is cached in the timeline until it is reset.
+// The in-progress operations end at now.
+func timelineContent(infos []*state.ResourceOperationInfo, now time.Time, width int, tl *Timeline) string {
+	var start, end time.Time
+	for _, info := range infos {
+		if start.IsZero() || info.StartTime.Before(start) {
+			start = info.StartTime
+		}
+		if e := endTime(info, now); e.After(end) {
+			end = e
+		}
+	}
+	if len(infos) == 0 {
+		return StyleComment.Render("No refresh or apply operation")
+	}
+
+	labelWidth := min(width/3, 60)
+	barWidth := max(width-labelWidth-1, 1)
+
+	// The total columns at this zoom level, the scroll offset is clamped accordingly.
+	total := barWidth << tl.Zoom
+	tl.Offset = min(tl.Offset, total-barWidth)
+	span := max(end.Sub(start), time.Second)
+	col := func(t time.Time) int {
+		return int(int64(t.Sub(start)) * int64(total) / int64(span))
+	}
+
+	if tl.critical == nil {
+		tl.critical = map[*state.ResourceOperationInfo]bool{}
+		for _, info := range concurrency.CriticalPath(infos, now) {
+			tl.critical[info] = true
+		}
+	}
+	critical := tl.critical
+
+	legend := fmt.Sprintf("%s complete %s errored %s running %s overdue ★ critical path    zoom: x%d",
+		styleBarComplete.Render("█"),
+		styleBarErrored.Render("█"),
+		styleBarRunning.Render("█"),
+		styleBarOverdue.Render("█"),
+		1<<tl.Zoom,
+	)
+	lines := []string{legend, strings.Repeat(" ", labelWidth+1) + timelineAxis(span, total, barWidth, tl.Offset)}
+
+	for _, info := range infos {
+		mark := "  "
+		if critical[info] {
+			mark = "★ "
+		}
+		label := truncate.StringWithTail(mark+info.Loc.Action+" "+info.Loc.ResourceAddr, uint(labelWidth), "…")
+		label += strings.Repeat(" ", max(labelWidth-lipgloss.Width(label), 0))
+		if critical[info] {
+			label = StyleWarning.Render(label)
+		}
+
+		from := col(info.StartTime) - tl.Offset
+		to := max(col(endTime(info, now))-tl.Offset, from+1)
+		from, to = max(from, 0), min(to, barWidth)
+
+		var bar string
+		if from < to {
+			bar = strings.Repeat(" ", from) + barStyle(info, now).Render(strings.Repeat("█", to-from))
+		}
+		lines = append(lines, label+" "+bar)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// timelineAxis renders the time axis, with a tick on every timelineTickStep columns.
+func timelineAxis(span time.Duration, total, width, offset int) string {
+	// The ticks are in seconds, unless zoomed in to less than a second per tick.
+	precision := time.Second
+	if span*timelineTickStep/time.Duration(total) < time.Second {
+		precision = 10 * time.Millisecond
+	}
+	axis := []rune(strings.Repeat(" ", width))
+	for c := 0; c < width; c += timelineTickStep {
+		tick := []rune("|" + (span * time.Duration(c+offset) / time.Duration(total)).Round(precision).String())
+		copy(axis[c:], tick[:min(len(tick), width-c)])
+	}
+	return StyleComment.Render(string(axis))
+}
+
+func barStyle(info *state.ResourceOperationInfo, now time.Time) lipgloss.Style {
+	switch {
+	case info.Overdue(now):
+		return styleBarOverdue
+	case info.Status == state.ResourceOperationStatusComplete:
+		return styleBarComplete
+	case info.Status == state.ResourceOperationStatusErrored:
+		return styleBarErrored
+	default:
+		return styleBarRunning
+	}
+}
+
+func endTime(info *state.ResourceOperationInfo, now time.Time) time.Time {
+	if info.EndTime.IsZero() {
+		return now
+	}
+	return info.EndTime
+}
@@ -0,0 +1,73 @@
+package ui
+
+import (
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/magodo/pipeform/internal/state"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTimelineContent(t *testing.T) {
+	base := time.Date(2025, 1, 10, 10, 0, 0, 0, time.UTC)
+	newInfo := func(addr string, start, end int) *state.ResourceOperationInfo {
+		info := &state.ResourceOperationInfo{
+			Loc:       state.ResourceOperationInfoLocator{ResourceAddr: addr, Action: "create"},
+			Status:    state.ResourceOperationStatusComplete,
+			StartTime: base.Add(time.Duration(start) * time.Second),
+			EndTime:   base.Add(time.Duration(end) * time.Second),
+		}
+		if end < 0 {
+			info.Status = state.ResourceOperationStatusStart
+			info.EndTime = time.Time{}
+		}
+		return info
+	}
+	infos := []*state.ResourceOperationInfo{
+		newInfo("a", 0, 10),
+		newInfo("b", 0, 5),
+		// Runs until now
+		newInfo("c", 10, -1),
+	}
+
+	// The label takes 30 columns, the bars take the rest 59 columns, i.e. about 20 columns for 10s.
+	label := func(s string) string {
+		return s + strings.Repeat(" ", 30-utf8.RuneCountInString(s)) + " "
+	}
+	var tl Timeline
+	lines := strings.Split(timelineContent(infos, base.Add(30*time.Second), 90, &tl), "\n")
+	require.Len(t, lines, 5)
+	require.Contains(t, lines[0], "zoom: x1")
+	require.Equal(t, "|0s", strings.TrimSpace(lines[1])[:3])
+	require.Equal(t, label("★ create a")+strings.Repeat("█", 19), lines[2])
+	require.Equal(t, label("  create b")+strings.Repeat("█", 9), lines[3])
+	require.Equal(t, label("★ create c")+strings.Repeat(" ", 19)+strings.Repeat("█", 40), lines[4])
+
+	// Zoom in and scroll to the end
+	tl.ZoomIn()
+	for i := 0; i < 10; i++ {
+		tl.ScrollRight()
+	}
+	lines = strings.Split(timelineContent(infos, base.Add(30*time.Second), 90, &tl), "\n")
+	require.Contains(t, lines[0], "zoom: x2")
+	require.Equal(t, 59, tl.Offset)
+	require.Equal(t, label("  create b"), lines[3])
+	require.Equal(t, label("★ create c")+strings.Repeat("█", 59), lines[4])
+
+	tl.ZoomOut()
+	require.Equal(t, 0, tl.Zoom)
+	require.Equal(t, 29, tl.Offset)
+
+	// The critical path is cached until the timeline is reset
+	infos[2].StartTime = base.Add(5 * time.Second)
+	lines = strings.Split(timelineContent(infos, base.Add(30*time.Second), 90, &tl), "\n")
+	require.Equal(t, label("★ create a"), lines[2][:len(label("★ create a"))])
+	tl.Reset()
+	lines = strings.Split(timelineContent(infos, base.Add(30*time.Second), 90, &tl), "\n")
+	require.Equal(t, label("  create a"), lines[2][:len(label("  create a"))])
+	require.Equal(t, label("★ create b"), lines[3][:len(label("★ create b"))])
+
+	require.Contains(t, timelineContent(nil, base, 90, &tl), "No refresh or apply operation")
+}
@@ -3,13 +3,23 @@ package ui
 import (
 	"fmt"
 	"io"
+	"slices"
 	"strings"
 	"time"
 
 	"github.com/magodo/pipeform/internal/clipboard"
+	"github.com/magodo/pipeform/internal/clock"
+	"github.com/magodo/pipeform/internal/concurrency"
 	"github.com/magodo/pipeform/internal/csv"
+	"github.com/magodo/pipeform/internal/engine"
+	"github.com/magodo/pipeform/internal/estimate"
+	"github.com/magodo/pipeform/internal/history"
 	"github.com/magodo/pipeform/internal/log"
+	"github.com/magodo/pipeform/internal/otlp"
+	"github.com/magodo/pipeform/internal/reader"
+	"github.com/magodo/pipeform/internal/report"
 	"github.com/magodo/pipeform/internal/state"
+	"github.com/magodo/pipeform/internal/trace"
 	"github.com/muesli/reflow/indent"
 
 	"github.com/charmbracelet/bubbles/help"
@@ -18,25 +28,32 @@ import (
 	"github.com/charmbracelet/bubbles/progress"
 	"github.com/charmbracelet/bubbles/spinner"
 	"github.com/charmbracelet/bubbles/table"
+	"github.com/charmbracelet/bubbles/viewport"
 	tea "github.com/charmbracelet/bubbletea"
-	"github.com/magodo/pipeform/internal/reader"
-	"github.com/magodo/pipeform/internal/terraform/views"
-	"github.com/magodo/pipeform/internal/terraform/views/json"
+	"github.com/magodo/pipeform/terraform/views"
 )
 
 const (
 	padding     = 2
 	indentLevel = 2
+
+	// defaultBatchSize is the maximum count of messages applied in one update.
+	defaultBatchSize = 1000
+
+	// The throughput sparkline covers the last minute.
+	throughputBuckets    = 12
+	throughputBucketSize = 5 * time.Second
 )
 
 type UIModel struct {
-	startTime time.Time
-	logger    *log.Logger
-	reader    reader.Reader
+	logger *log.Logger
+	reader *reader.AsyncReader
+	clock  clock.Clock
+
+	batchSize int
 
-	// state is the actual state of the process
-	state         ViewState
-	visitedStates []ViewState
+	// engine maintains the actual state of the process
+	engine *engine.Engine
 	// viewState is the state of the current view. It is nil until EOF received.
 	// After which, users can select different view.
 	viewState *ViewState
@@ -45,21 +62,19 @@ type UIModel struct {
 	userOperationInfo string
 
 	isEOF bool
+	// eofTime is when the stream reaches EOF, which is the end of the run for the exports
+	eofTime time.Time
 
-	diags Diags
-
-	refreshInfos state.ResourceOperationInfos
-	planInfos    state.PlanInfos
-	applyInfos   state.ResourceOperationInfos
-	outputInfos  state.OutputInfos
+	// percent is the target percentage of the progress bar
+	percent float64
 
-	versionMsg *string
+	// est, throughput and inFlight are refreshed on a one second pace, during the refresh and the apply
+	est        estimate.Estimate
+	throughput []int
+	inFlight   int
 
-	// These are read from the ChangeSummaryMsg
-	operation json.Operation
-	totalCnt  int
-
-	doneCnt int
+	// parallelism is the -parallelism of Terraform, against which the concurrency is analyzed
+	parallelism int
 
 	keymap KeyMap
 
@@ -68,15 +83,89 @@ type UIModel struct {
 	table     table.Model
 	progress  progress.Model
 	paginator paginator.Model
+	viewport  viewport.Model
+
+	page Page
+	// detailsInfo is the resource operation shown in the details page
+	detailsInfo *state.ResourceOperationInfo
+	// timeline is the zoom and the scroll of the timeline page
+	timeline Timeline
 
 	tableSize Size
 
 	cp clipboard.Clipboard
 
 	followed bool
+
+	// proc is the child process that produces the stream, only set in wrap mode.
+	proc Process
+	// interruptCnt counts the quit key presses while the child process is running.
+	interruptCnt int
+
+	// player is only set when replaying a recorded stream.
+	player Player
+	paused bool
+
+	// history is only used to create the engine
+	history *history.History
+}
+
+// Process is the child process (e.g. terraform) that produces the stream, if pipeform launches it.
+type Process interface {
+	Interrupt() error
+	Kill() error
+}
+
+// Player controls the replay of a recorded stream.
+type Player interface {
+	// TogglePause pauses or resumes the replay, returns whether the replay is paused afterwards.
+	TogglePause() bool
+	// SkipUntil fast forwards the replay until the predicate returns true for a message.
+	SkipUntil(func(views.Message) bool)
+}
+
+type Option func(*UIModel)
+
+// WithProcess makes the quit key to interrupt (first press) and kill (second press) the child process,
+// instead of quitting the program directly.
+func WithProcess(proc Process) Option {
+	return func(m *UIModel) {
+		m.proc = proc
+	}
+}
+
+// WithClock sets the clock used to calculate the durations, which defaults to the wall clock.
+func WithClock(clock clock.Clock) Option {
+	return func(m *UIModel) {
+		m.clock = clock
+	}
 }
 
-func NewRuntimeModel(logger *log.Logger, reader reader.Reader, startTime time.Time) UIModel {
+// WithPlayer enables the keys to control the replay.
+func WithPlayer(player Player) Option {
+	return func(m *UIModel) {
+		m.player = player
+		m.keymap.EnablePlayer(true)
+	}
+}
+
+// WithParallelism sets the -parallelism of Terraform, which defaults to concurrency.DefaultParallelism.
+func WithParallelism(n int) Option {
+	return func(m *UIModel) {
+		m.parallelism = n
+	}
+}
+
+// WithHistory shows the expected durations of the operations from the history, and highlights the overdue ones.
+func WithHistory(h *history.History) Option {
+	return func(m *UIModel) {
+		m.history = h
+	}
+}
+
+// NewRuntimeModel creates the model. If startTime is zero, the timestamp of the first message is used instead.
+// The messages are read in a separate goroutine, and applied in batches.
+func NewRuntimeModel(logger *log.Logger, r reader.MessageReader, startTime time.Time, opts ...Option) UIModel {
 	t := table.New(table.WithFocused(true))
 	t.SetStyles(StyleTableFunc())
 
@@ -91,40 +180,42 @@ func NewRuntimeModel(logger *log.Logger, reader reader.Reader, startTime time.Ti
 	p.InactiveDot = StyleInactiveDot
 
 	model := UIModel{
-		startTime:     startTime,
-		logger:        logger,
-		reader:        reader,
-		state:         ViewStateIdle,
-		visitedStates: []ViewState{ViewStateIdle},
-		keymap:        keymap,
-		help:          help.New(),
-		spinner:       spinner.New(),
-		table:         t,
-		progress:      progress.New(),
-		paginator:     p,
-		cp:            cp,
+		logger:      logger,
+		reader:      reader.NewAsyncReader(r, reader.DefaultBufferSize),
+		clock:       clock.Real(),
+		batchSize:   defaultBatchSize,
+		parallelism: concurrency.DefaultParallelism,
+		keymap:      keymap,
+		help:        help.New(),
+		spinner:     spinner.New(),
+		table:       t,
+		progress:    progress.New(),
+		paginator:   p,
+		viewport:    viewport.New(0, 0),
+		cp:          cp,
+	}
+
+	for _, opt := range opts {
+		opt(&model)
 	}
 
+	model.engine = engine.New(logger, startTime, engine.WithHistory(model.history))
+
 	return model
 }
 
-func (m UIModel) Diags() Diags {
-	return m.diags
+func (m UIModel) Diags() engine.Diags {
+	return m.engine.Diags()
 }
 
 func (m UIModel) IsEOF() bool {
 	return m.isEOF
 }
 
+// nextMessage blocks until there are messages read, then returns all the pending ones (up to the batch size).
 func (m UIModel) nextMessage() tea.Msg {
-	msg, err := m.reader.Next()
-	if err != nil {
-		if err == io.EOF {
-			return receiverEOFMsg{}
-		}
-		return receiverErrorMsg{err: err}
-	}
-	return receiverMsg{msg: msg}
+	msgs, err := m.reader.NextBatch(m.batchSize)
+	return receiverBatchMsg{msgs: msgs, err: err}
 }
 
 func (m UIModel) Init() tea.Cmd {
@@ -138,6 +229,12 @@ func (m UIModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		m.userOperationInfo = ""
 		switch {
 		case key.Matches(msg, m.keymap.Quit):
+			// Once the child process is killed, the program quits anyway, as the stream might never reach EOF,
+			// e.g. a grandchild process still holds the pipe.
+			if m.proc != nil && !m.isEOF && !m.killed() {
+				m.interruptChild()
+				return m, nil
+			}
 			m.logger.Warn("Interrupt key received, quit the program")
 			return m, tea.Quit
 		case key.Matches(msg, m.keymap.Help):
@@ -149,13 +246,67 @@ func (m UIModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		case key.Matches(msg, m.keymap.Copy):
 			m.copyTableRow()
 			return m, nil
+		case key.Matches(msg, m.keymap.RawLines):
+			m.togglePage(PageRawLines)
+			return m, nil
+		case key.Matches(msg, m.keymap.Details):
+			if m.page != PageDetails {
+				m.detailsInfo = m.selectedOperationInfo()
+			}
+			m.togglePage(PageDetails)
+			return m, nil
+		case key.Matches(msg, m.keymap.Diagnostics):
+			m.togglePage(PageDiagnostics)
+			return m, nil
+		case key.Matches(msg, m.keymap.JumpToDiag):
+			if m.isTablePage() {
+				m.jumpToDiag()
+			}
+			return m, nil
+		case key.Matches(msg, m.keymap.Aux):
+			m.togglePage(PageAux)
+			return m, nil
+		case key.Matches(msg, m.keymap.Concurrency):
+			m.togglePage(PageConcurrency)
+			return m, nil
+		case key.Matches(msg, m.keymap.Timeline):
+			m.toggleTimeline()
+			return m, nil
+		case key.Matches(msg, m.keymap.ZoomIn):
+			m.timeline.ZoomIn()
+			m.setPageContent()
+			return m, nil
+		case key.Matches(msg, m.keymap.ZoomOut):
+			m.timeline.ZoomOut()
+			m.setPageContent()
+			return m, nil
+		case key.Matches(msg, m.keymap.ScrollLeft):
+			m.timeline.ScrollLeft()
+			m.setPageContent()
+			return m, nil
+		case key.Matches(msg, m.keymap.ScrollRight):
+			m.timeline.ScrollRight()
+			m.setPageContent()
+			return m, nil
+		case key.Matches(msg, m.keymap.Pause):
+			m.paused = m.player.TogglePause()
+			return m, nil
+		case key.Matches(msg, m.keymap.NextPhase):
+			// The predicate runs in the reader's goroutine, where the copied state is tracked independently.
+			st := m.engine.Phase()
+			m.player.SkipUntil(func(msg views.Message) bool {
+				var change bool
+				st, change = st.NextPhase(msg)
+				return change
+			})
+			m.userOperationInfo = "Skipping to the next phase..."
+			return m, nil
 		case key.Matches(msg, m.keymap.PaginatorMap.PrevPage):
 			if m.viewState == nil {
 				return m, nil
 			}
 			m.paginator.PrevPage()
-			idx, _ := m.paginator.GetSliceBounds(len(m.visitedStates))
-			m.viewState = &m.visitedStates[idx]
+			m.setViewState()
 			m.resetTableNonEmpty()
 			return m, nil
 		case key.Matches(msg, m.keymap.PaginatorMap.NextPage):
@@ -163,11 +314,15 @@ func (m UIModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				return m, nil
 			}
 			m.paginator.NextPage()
-			idx, _ := m.paginator.GetSliceBounds(len(m.visitedStates))
-			m.viewState = &m.visitedStates[idx]
+			m.setViewState()
 			m.resetTableNonEmpty()
 			return m, nil
 		default:
+			if !m.isTablePage() {
+				viewport, cmd := m.viewport.Update(msg)
+				m.viewport = viewport
+				return m, cmd
+			}
 			table, cmd := m.table.Update(msg)
 			m.table = table
 			return m, cmd
@@ -183,6 +338,10 @@ func (m UIModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		m.setTableOutlook()
 		m.setTableRows()
 
+		m.viewport.Width = m.tableSize.Width
+		m.viewport.Height = m.tableSize.Height
+		m.setPageContent()
+
 		return m, nil
 
 	// FrameMsg is sent when the progress bar wants to animate itself
@@ -198,222 +357,237 @@ func (m UIModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		return m, cmd
 
 	case tickMsg:
+		// The in-progress operations grow with the time, which might change the critical path.
+		if len(m.engine.RefreshInfos().Running())+len(m.engine.ApplyInfos().Running()) != 0 {
+			m.timeline.Reset()
+		}
+		m.setEstimate()
 		m.setTableRows()
+		if m.page == PageDetails || m.page == PageConcurrency || m.page == PageTimeline {
+			m.setPageContent()
+		}
 		return m, tickCmd()
 
-	// Log the receiver error message
-	case receiverErrorMsg:
-		m.logger.Error("Receiver error", "error", msg.Error())
-		return m, m.nextMessage
+	case receiverBatchMsg:
+		m.logger.Debug("Message receiverBatchMsg received", "count", len(msg.msgs))
 
-	case receiverEOFMsg:
-		m.logger.Info("Receiver reaches EOF")
-		m.isEOF = true
-		m.lastLog = fmt.Sprintf("Time spent: %s", time.Now().Sub(m.startTime).Truncate(time.Second))
+		var cmds []tea.Cmd
 
-		// Enable paginator
-		m.paginator.SetTotalPages(len(m.visitedStates))
-		for i := 0; i < len(m.visitedStates); i++ {
-			m.paginator.NextPage()
+		percent := m.percent
+		rawLineCnt := len(m.engine.RawLines())
+		diagCnt := len(m.engine.Diags())
+
+		var stateChanged bool
+		for _, msg := range msg.msgs {
+			if m.applyMessage(msg) {
+				stateChanged = true
+			}
 		}
-		m.viewState = &m.state
-		m.keymap.EnablePaginator()
 
-		return m, nil
+		// Only rebuild the rows (and the page content) once for the whole batch.
+		if stateChanged {
+			m.resetTableNonEmpty()
+		} else {
+			m.setTableRows()
+		}
+		if (m.page == PageRawLines && len(m.engine.RawLines()) != rawLineCnt) ||
+			(m.page == PageDiagnostics && len(m.engine.Diags()) != diagCnt) ||
+			m.page == PageDetails || m.page == PageTimeline {
+			m.setPageContent()
+		}
+		if m.percent != percent {
+			cmds = append(cmds, m.progress.SetPercent(m.percent))
+		}
 
-	case receiverMsg:
-		m.logger.Debug("Message receiverMsg received", "type", fmt.Sprintf("%T", msg.msg))
+		switch msg.err {
+		case nil:
+			cmds = append(cmds, m.nextMessage)
+		case io.EOF:
+			m.handleEOF()
+		default:
+			// The reader stops at the first error, the stream is regarded as broken.
+			m.logger.Error("Receiver error", "error", msg.err)
+		}
 
-		cmds := []tea.Cmd{m.nextMessage}
+		return m, tea.Batch(cmds...)
 
-		m.lastLog = msg.msg.BaseMessage().Message
+	default:
+		return m, nil
+	}
+}
 
-		switch msg := msg.msg.(type) {
-		case views.VersionMsg:
-			m.versionMsg = &msg.BaseMsg.Message
+// handleEOF enables the paginator, so that users can view the tables of all the visited states, followed by
+// the timeline.
+func (m *UIModel) handleEOF() {
+	m.logger.Info("Receiver reaches EOF")
+	m.isEOF = true
+	m.eofTime = m.clock.Now()
+	m.lastLog = fmt.Sprintf("Time spent: %s", m.eofTime.Sub(m.engine.StartTime()).Truncate(time.Second))
+
+	// Enable paginator
+	phases := m.engine.VisitedPhases()
+	m.paginator.SetTotalPages(len(phases) + 1)
+	for i := 0; i < len(phases)-1; i++ {
+		m.paginator.NextPage()
+	}
+	if m.page == PageTimeline {
+		m.paginator.NextPage()
+	}
+	m.setViewState()
+	m.keymap.EnablePaginator()
+	m.keymap.EnablePlayer(false)
+}
 
-		case views.LogMsg:
-			// There's no much useful information for now.
-		case views.DiagnosticsMsg:
-			switch strings.ToLower(msg.Level) {
-			case "warn", "error":
-				m.diags = append(m.diags, *msg.Diagnostic)
+// applyMessage applies a message to the engine, without updating the table rows.
+// It returns whether the view state changes.
+func (m *UIModel) applyMessage(msg views.Message) bool {
+	m.logger.Debug("Message received", "type", fmt.Sprintf("%T", msg))
+
+	m.lastLog = msg.BaseMessage().Message
+
+	var change bool
+	for _, ev := range m.engine.Apply(msg) {
+		switch ev := ev.(type) {
+		case engine.ProgressEvent:
+			// Specifically, if the total count is 0, the progress is 100% anyway.
+			m.percent = 1
+			if ev.Total != 0 {
+				m.percent = float64(ev.Done) / float64(ev.Total)
 			}
+		case engine.PhaseChangedEvent:
+			change = true
+		case engine.OperationEvent:
+			m.timeline.Reset()
+		case engine.UnsupportedVersionEvent:
+			m.userOperationInfo = ev.Diag.Summary + ": " + ev.Diag.Detail
+		}
+	}
+	return change
+}
 
-		case views.ResourceDriftMsg:
-			// There's no much useful information for now.
-
-		case views.PlannedChangeMsg:
-			m.planInfos = append(m.planInfos, &state.PlanInfo{
-				Resource:     msg.Change.Resource,
-				Action:       msg.Change.Action,
-				PrevResource: msg.Change.PreviousResource,
-				Reason:       msg.Change.Reason,
-			})
+// setViewState sets the view state to the visited state selected by the paginator.
+// The last page of the paginator is the timeline, whose view state is the last visited state.
+func (m *UIModel) setViewState() {
+	phases := m.engine.VisitedPhases()
+	idx, _ := m.paginator.GetSliceBounds(len(phases) + 1)
+	if idx == len(phases) {
+		vs := phases[len(phases)-1]
+		m.viewState = &vs
+		m.setPage(PageTimeline)
+		return
+	}
+	vs := phases[idx]
+	m.viewState = &vs
+	if m.page == PageTimeline {
+		m.setPage(PageTable)
+	}
+}
 
-			// Normally, we don't need to handle the PlannedChangeMsg here, as the ChangeSummaryMsg has all these information.
-			// The exception is that when apply with a plan file, there is no ChangeSummaryMsg sent from Terraform at this moment.
-			// (see: https://github.com/magodo/pipeform/issues/1)
-			// The counting here is a fallback logic to cover the case above. Otherwise, it will just be overwritten by ChangeSummaryMsg.
-			//
-			// TODO: Once https://github.com/hashicorp/terraform/pull/36245 merged, remove this part.
-			//
-			// Referencing the logic of terraform: internal/command/views/operation.go
-			// But we also count the "import"
-			switch msg.Change.Action {
-			case json.ActionCreate:
-				m.totalCnt++
-			case json.ActionDelete:
-				m.totalCnt++
-			case json.ActionUpdate:
-				m.totalCnt++
-			case json.ActionReplace:
-				m.totalCnt += 2
-			case json.ActionImport:
-				m.totalCnt++
-			}
+// toggleTimeline toggles the timeline page. After EOF, it selects (or deselects) the last page of the paginator
+// instead, which is the timeline.
+func (m *UIModel) toggleTimeline() {
+	if m.viewState == nil {
+		m.togglePage(PageTimeline)
+		return
+	}
+	n := len(m.engine.VisitedPhases())
+	if m.page == PageTimeline {
+		m.paginator.Page = n - 1
+	} else {
+		m.paginator.Page = n
+	}
+	m.setViewState()
+	m.resetTableNonEmpty()
+}
 
-		case views.ChangeSummaryMsg:
-			changes := msg.Changes
-			m.logger.Debug("Change summary", "add", changes.Add, "change", changes.Change, "import", changes.Import, "remove", changes.Remove)
-			m.totalCnt = changes.Add + changes.Change + changes.Import + changes.Remove
-			m.operation = changes.Operation
+// interruptChild gracefully interrupts the child process on the first call, and kills it on the second call.
+// The program keeps running until the stream reaches EOF, so that the diagnostics are still received.
+func (m *UIModel) interruptChild() {
+	m.interruptCnt++
+	if m.interruptCnt == 1 {
+		m.logger.Warn("Interrupt key received, interrupt the child process")
+		if err := m.proc.Interrupt(); err != nil {
+			m.logger.Error("Interrupting the child process", "error", err)
+		}
+		m.userOperationInfo = "Interrupting... Press again to kill"
+		return
+	}
+	m.logger.Warn("Interrupt key received again, kill the child process")
+	if err := m.proc.Kill(); err != nil {
+		m.logger.Error("Killing the child process", "error", err)
+	}
+	m.userOperationInfo = "Killed! Press again to quit"
+}
 
-			// Specifically, if the total count is 0, we update the progress bar directly as it is 100% anyway.
-			if m.totalCnt == 0 {
-				cmds = append(cmds, m.progress.SetPercent(1))
-			}
+// killed tells whether the child process has been killed by interruptChild.
+func (m UIModel) killed() bool {
+	return m.interruptCnt > 1
+}
 
-		case views.OutputMsg:
-			for name, o := range msg.Outputs {
-				if o.Action != "" {
-					continue
-				}
-				m.outputInfos = append(m.outputInfos, &state.OutputInfo{
-					Name:      name,
-					Sensitive: o.Sensitive,
-					Type:      o.Type,
-					ValueStr:  o.Value,
-					Action:    o.Action,
-				})
-			}
+// togglePage toggles between the page and the table.
+func (m *UIModel) togglePage(page Page) {
+	if m.page == page {
+		m.setPage(PageTable)
+		return
+	}
+	m.setPage(page)
+	m.viewport.GotoTop()
+}
 
-		case views.HookMsg:
-			m.logger.Debug("Hook message", "type", fmt.Sprintf("%T", msg.Hook))
-			switch hook := msg.Hook.(type) {
-			case json.RefreshStart:
-				res := &state.ResourceOperationInfo{
-					Idx:             len(m.refreshInfos) + 1,
-					RawResourceAddr: hook.Resource,
-					Loc: state.ResourceOperationInfoLocator{
-						Module:       hook.Resource.Module,
-						ResourceAddr: hook.Resource.Addr,
-						Action:       "refresh",
-					},
-					Status:    state.ResourceOperationStatusStart,
-					StartTime: msg.TimeStamp,
-				}
-				m.refreshInfos = append(m.refreshInfos, res)
-
-			case json.RefreshComplete:
-				loc := state.ResourceOperationInfoLocator{
-					Module:       hook.Resource.Module,
-					ResourceAddr: hook.Resource.Addr,
-					Action:       "refresh",
-				}
-				status := state.ResourceOperationStatusComplete
-				update := state.ResourceOperationInfoUpdate{
-					Status:  &status,
-					Endtime: &msg.TimeStamp,
-				}
-				if m.refreshInfos.Update(loc, update) == nil {
-					m.logger.Error("RefreshComplete hook can't find the resource info", "module", hook.Resource.Module, "addr", hook.Resource.Addr, "action", "refresh")
-					break
-				}
-
-			case json.OperationStart:
-				res := &state.ResourceOperationInfo{
-					Idx:             len(m.applyInfos) + 1,
-					RawResourceAddr: hook.Resource,
-					Loc: state.ResourceOperationInfoLocator{
-						Module:       hook.Resource.Module,
-						ResourceAddr: hook.Resource.Addr,
-						Action:       string(hook.Action),
-					},
-					Status:    state.ResourceOperationStatusStart,
-					StartTime: msg.TimeStamp,
-				}
-				m.applyInfos = append(m.applyInfos, res)
-
-			case json.OperationProgress:
-				// Ignore
-
-			case json.OperationComplete:
-				loc := state.ResourceOperationInfoLocator{
-					Module:       hook.Resource.Module,
-					ResourceAddr: hook.Resource.Addr,
-					Action:       string(hook.Action),
-				}
-				status := state.ResourceOperationStatusComplete
-				update := state.ResourceOperationInfoUpdate{
-					Status:  &status,
-					Endtime: &msg.TimeStamp,
-				}
-				if m.applyInfos.Update(loc, update) == nil {
-					m.logger.Error("OperationComplete hook can't find the resource info", "module", hook.Resource.Module, "addr", hook.Resource.Addr, "action", hook.Action)
-					break
-				}
-
-				m.doneCnt += 1
-				percentage := float64(m.doneCnt) / float64(m.totalCnt)
-				cmds = append(cmds, m.progress.SetPercent(percentage))
-
-			case json.OperationErrored:
-				loc := state.ResourceOperationInfoLocator{
-					Module:       hook.Resource.Module,
-					ResourceAddr: hook.Resource.Addr,
-					Action:       string(hook.Action),
-				}
-				status := state.ResourceOperationStatusErrored
-				update := state.ResourceOperationInfoUpdate{
-					Status:  &status,
-					Endtime: &msg.TimeStamp,
-				}
-				if m.applyInfos.Update(loc, update) == nil {
-					m.logger.Error("OperationErrored hook can't find the resource info", "module", hook.Resource.Module, "addr", hook.Resource.Addr, "action", hook.Action)
-					break
-				}
-
-				m.doneCnt += 1
-				percentage := float64(m.doneCnt) / float64(m.totalCnt)
-				cmds = append(cmds, m.progress.SetPercent(percentage))
-
-			case json.ProvisionStart:
-			case json.ProvisionProgress:
-			case json.ProvisionComplete:
-			case json.ProvisionErrored:
-			default:
-			}
-		default:
-			panic(fmt.Sprintf("unknown message type: %T", msg))
-		}
+func (m *UIModel) setPage(page Page) {
+	// The table is shared by the aux page and the table page, its columns are reset when switching between them.
+	wasAux := m.page == PageAux
+	m.page = page
+	if wasAux != (page == PageAux) {
+		m.resetTableNonEmpty()
+	}
+	m.keymap.EnableTimeline(page == PageTimeline)
+	m.setPageContent()
+}
 
-		// Update viewState
-		var change bool
-		oldState := m.state
-		m.state, change = m.state.NextState(msg.msg)
-		if change {
-			m.logger.Info("View State change", "old", oldState.String(), "new", m.state.String())
-			m.visitedStates = append(m.visitedStates, m.state)
-			m.resetTableEmpty()
-		} else {
-			m.setTableRows()
-		}
+// isTablePage tells whether the current page is rendered with the table.
+func (m *UIModel) isTablePage() bool {
+	return m.page == PageTable || m.page == PageAux
+}
 
-		return m, tea.Batch(cmds...)
+// jumpToDiag shows the first diagnostic of the selected resource operation in the diagnostics page.
+func (m *UIModel) jumpToDiag() {
+	info := m.selectedOperationInfo()
+	if info == nil || len(info.Diags) == 0 {
+		m.userOperationInfo = "No diagnostic for the selected row"
+		return
+	}
+	m.setPage(PageDiagnostics)
+	if offset, ok := diagnosticOffset(m.engine.Diags(), info.Diags[0], m.viewport.Width); ok {
+		m.viewport.SetYOffset(offset)
+	}
+}
 
-	default:
-		return m, nil
+func (m *UIModel) setPageContent() {
+	switch m.page {
+	case PageRawLines:
+		atBottom := m.viewport.AtBottom()
+		m.viewport.SetContent(strings.Join(m.engine.RawLines(), "\n"))
+		if m.followed || atBottom {
+			m.viewport.GotoBottom()
+		}
+	case PageDetails:
+		atBottom := m.viewport.AtBottom()
+		m.viewport.SetContent(detailsContent(m.detailsInfo, m.clock.Now()))
+		if m.followed || atBottom {
+			m.viewport.GotoBottom()
+		}
+	case PageDiagnostics:
+		atBottom := m.viewport.AtBottom()
+		m.viewport.SetContent(diagnosticsContent(m.engine.Diags(), m.viewport.Width))
+		if m.followed || atBottom {
+			m.viewport.GotoBottom()
+		}
+	case PageConcurrency:
+		m.viewport.SetContent(concurrencyContent(concurrency.Analyze(m.engine.ApplyInfos().All(), m.parallelism, m.clock.Now())))
+	case PageTimeline:
+		infos := slices.Concat(m.engine.RefreshInfos().All(), m.engine.ApplyInfos().All())
+		m.viewport.SetContent(timelineContent(infos, m.clock.Now(), m.viewport.Width, &m.timeline))
 	}
 }
 
@@ -435,29 +609,44 @@ func (m *UIModel) setTableOutlook() {
 	m.table.SetWidth(m.tableSize.Width)
 	m.table.SetHeight(m.tableSize.Height)
 
+	if m.page == PageAux {
+		m.table.SetColumns(m.engine.AuxInfos().ToColumns(m.tableSize.Width))
+		return
+	}
+
 	switch m.getViewState() {
 	case ViewStateRefresh:
-		m.table.SetColumns(m.refreshInfos.ToColumns(m.tableSize.Width))
+		m.table.SetColumns(m.engine.RefreshInfos().ToColumns(m.tableSize.Width))
+	case ViewStateDrift:
+		m.table.SetColumns(m.engine.DriftInfos().ToColumns(m.tableSize.Width))
 	case ViewStatePlan:
-		m.table.SetColumns(m.planInfos.ToColumns(m.tableSize.Width))
+		m.table.SetColumns(m.engine.PlanInfos().ToColumns(m.tableSize.Width))
 	case ViewStateApply:
-		m.table.SetColumns(m.applyInfos.ToColumns(m.tableSize.Width))
+		m.table.SetColumns(m.engine.ApplyInfos().ToColumns(m.tableSize.Width))
 	case ViewStateSummary:
-		m.table.SetColumns(m.outputInfos.ToColumns(m.tableSize.Width))
+		m.table.SetColumns(m.engine.OutputInfos().ToColumns(m.tableSize.Width))
+	case ViewStateTest:
+		m.table.SetColumns(m.engine.TestInfos().ToColumns(m.tableSize.Width))
 	}
 }
 
 // setTableRows on a one second pace.
 func (m *UIModel) setTableRows() {
-	switch m.getViewState() {
-	case ViewStateRefresh:
-		m.table.SetRows(m.refreshInfos.ToRows(0))
-	case ViewStatePlan:
-		m.table.SetRows(m.planInfos.ToRows())
-	case ViewStateApply:
-		m.table.SetRows(m.applyInfos.ToRows(m.totalCnt))
-	case ViewStateSummary:
-		m.table.SetRows(m.outputInfos.ToRows())
+	switch vs := m.getViewState(); {
+	case m.page == PageAux:
+		m.table.SetRows(m.engine.AuxInfos().ToRows(0, m.clock.Now()))
+	case vs == ViewStateRefresh:
+		m.table.SetRows(m.engine.RefreshInfos().ToRows(0, m.clock.Now()))
+	case vs == ViewStateDrift:
+		m.table.SetRows(m.engine.DriftInfos().ToRows())
+	case vs == ViewStatePlan:
+		m.table.SetRows(m.engine.PlanInfos().ToRows())
+	case vs == ViewStateApply:
+		m.table.SetRows(m.engine.ApplyInfos().ToRows(m.engine.TotalCount(), m.clock.Now()))
+	case vs == ViewStateSummary:
+		m.table.SetRows(m.engine.OutputInfos().ToRows())
+	case vs == ViewStateTest:
+		m.table.SetRows(m.engine.TestInfos().ToRows(m.clock.Now()))
 	}
 
 	if m.followed {
@@ -465,21 +654,37 @@ func (m *UIModel) setTableRows() {
 	}
 }
 
+// setEstimate estimates the operations of the current phase, if it is the refresh or the apply.
+func (m *UIModel) setEstimate() {
+	var infos state.ResourceOperationInfos
+	var total int
+	switch m.engine.Phase() {
+	case engine.PhaseRefresh:
+		infos = m.engine.RefreshInfos()
+	case engine.PhaseApply:
+		infos, total = m.engine.ApplyInfos(), m.engine.TotalCount()
+	default:
+		m.est, m.throughput = estimate.Estimate{}, nil
+		return
+	}
+	now := m.clock.Now()
+	m.inFlight = len(infos.Running())
+	m.est = estimate.New(infos, total, now)
+	m.throughput = estimate.Throughput(infos, now, throughputBuckets, throughputBucketSize)
+}
+
 func (m *UIModel) copyTableRow() {
 	if !m.cp.Enabled() {
 		return
 	}
 
-	switch m.getViewState() {
-	case ViewStateRefresh:
-		if row := m.table.SelectedRow(); len(row) > 4 {
-			m.cp.Write([]byte(row[4]))
-		}
-	case ViewStateApply:
-		if row := m.table.SelectedRow(); len(row) > 4 {
-			m.cp.Write([]byte(row[4]))
+	switch vs := m.getViewState(); {
+	case m.page == PageAux || vs == ViewStateRefresh || vs == ViewStateApply:
+		// The resource column might be decorated, e.g. with the provisioner sub-status
+		if info := m.selectedOperationInfo(); info != nil {
+			m.cp.Write([]byte(info.Loc.ResourceAddr))
 		}
-	case ViewStateSummary:
+	case vs == ViewStateSummary:
 		if row := m.table.SelectedRow(); len(row) > 4 {
 			m.cp.Write([]byte(row[4]))
 		}
@@ -488,24 +693,60 @@ func (m *UIModel) copyTableRow() {
 	m.userOperationInfo = "Copied!"
 }
 
+// selectedOperationInfo returns the resource operation of the selected table row, if any.
+func (m *UIModel) selectedOperationInfo() *state.ResourceOperationInfo {
+	var infos []*state.ResourceOperationInfo
+	switch vs := m.getViewState(); {
+	case m.page == PageAux:
+		infos = m.engine.AuxInfos().All()
+	case vs == ViewStateRefresh:
+		infos = m.engine.RefreshInfos().All()
+	case vs == ViewStateApply:
+		// In the same order as the table rows
+		infos = slices.Concat(m.engine.ApplyInfos().All(), m.engine.ApplyInfos().Pending())
+	}
+	if idx := m.table.Cursor(); idx >= 0 && idx < len(infos) {
+		return infos[idx]
+	}
+	return nil
+}
+
 func (m UIModel) ToCsv() []byte {
-	return csv.ToCsv(csv.Input{
-		RefreshInfos: m.refreshInfos,
-		ApplyInfos:   m.applyInfos,
-	})
+	return csv.ToCsv(m.engine, m.endTime())
+}
+
+func (m UIModel) ToHTML() ([]byte, error) {
+	return report.HTML(m.engine, m.endTime())
+}
+
+func (m UIModel) ToTrace() ([]byte, error) {
+	return trace.JSON(m.engine, m.endTime())
+}
+
+func (m UIModel) ToSpans() *otlp.Span {
+	return otlp.Spans(m.engine, m.endTime())
+}
+
+// endTime returns the end of the run for the exports, i.e. when the stream reaches EOF. The time the users spend
+// browsing after EOF isn't counted. It is the current time if the run is interrupted.
+func (m UIModel) endTime() time.Time {
+	if m.isEOF {
+		return m.eofTime
+	}
+	return m.clock.Now()
 }
 
 func (m *UIModel) getViewState() ViewState {
 	if m.viewState != nil {
 		return *m.viewState
 	}
-	return m.state
+	return m.engine.Phase()
 }
 
 func (m UIModel) logoView() string {
 	msg := "pipeform"
-	if m.versionMsg != nil {
-		msg += fmt.Sprintf(" (%s)", *m.versionMsg)
+	if v := m.engine.Version(); v != "" {
+		msg += fmt.Sprintf(" (%s)", v)
 	}
 	return StyleTitle.Render(" " + msg + " ")
 }
@@ -513,19 +754,60 @@ func (m UIModel) logoView() string {
 func (m UIModel) stateView() string {
 	prefix := m.spinner.View()
 	if m.isEOF {
-		if m.diags.HasError() {
+		if m.engine.Diags().HasError() {
 			prefix = "❌"
 		} else {
 			prefix = "✅"
 		}
 	}
 
-	s := prefix + " " + StyleSubtitle.Render(m.getViewState().String())
+	title := m.getViewState().String()
+	if m.page != PageTable {
+		title = m.page.String()
+	}
+	s := prefix + " " + StyleSubtitle.Render(title)
 
 	if m.followed {
 		s += " [following]"
 	}
 
+	if m.paused {
+		s += " [paused]"
+	}
+
+	warnings, errors := m.engine.Diags().Count()
+	if errors != 0 {
+		s += " " + StyleErrorMsg.Render(fmt.Sprintf("[errors: %d]", errors))
+	}
+	if warnings != 0 {
+		s += " " + StyleWarning.Render(fmt.Sprintf("[warnings: %d]", warnings))
+	}
+
+	if aux := m.engine.AuxInfos(); aux.Len() != 0 {
+		s += " " + StyleComment.Render(fmt.Sprintf("[read/ephemeral: %d/%d]", m.engine.AuxDoneCount(), aux.Len()))
+	}
+
+	if n := len(m.engine.RefreshInfos().Overdue(m.clock.Now())) + len(m.engine.ApplyInfos().Overdue(m.clock.Now())); n != 0 {
+		s += " " + StyleWarning.Render(fmt.Sprintf("[overdue: %d]", n))
+	}
+
+	if n := len(m.engine.DriftInfos()); n != 0 {
+		s += " " + StyleWarning.Render(fmt.Sprintf("[drift: %d]", n))
+	}
+
+	if n := len(m.engine.RawLines()); n != 0 {
+		s += " " + StyleWarning.Render(fmt.Sprintf("[raw lines: %d]", n))
+	}
+
+	if !m.isEOF && m.throughput != nil {
+		est := fmt.Sprintf("in flight %d/%d • ", m.inFlight, m.parallelism)
+		if m.est.OK {
+			est += fmt.Sprintf("ETA %s • ", m.est.Remaining)
+		}
+		est += fmt.Sprintf("%.1f ops/min %s", m.est.Rate, estimate.Sparkline(m.throughput))
+		s += " " + StyleComment.Render(est)
+	}
+
 	if m.lastLog != "" {
 		s += "  " + StyleComment.Render(m.lastLog)
 	}
@@ -538,12 +820,14 @@ func (m UIModel) View() string {
 
 	s += "\n\n" + m.stateView()
 
-	if m.getViewState() != ViewStateIdle {
+	if !m.isTablePage() {
+		s += "\n\n" + StyleTableBase.Render(m.viewport.View())
+	} else if m.page == PageAux || m.getViewState() != ViewStateIdle {
 		s += "\n\n" + StyleTableBase.Render(m.table.View())
 	}
 
 	var progressBar string
-	if m.getViewState() == ViewStateApply {
+	if vs := m.getViewState(); vs == ViewStateApply || vs == ViewStateTest {
 		progressBar = m.progress.View()
 	}
 	s += "\n\n" + progressBar
@@ -0,0 +1,187 @@
+package ui
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/magodo/pipeform/internal/enginetest"
+	"github.com/magodo/pipeform/internal/log"
+	"github.com/magodo/pipeform/internal/reader"
+	"github.com/magodo/pipeform/terraform/views"
+	"github.com/magodo/pipeform/tool/streamgen/stream"
+	"github.com/stretchr/testify/require"
+)
+
+// applyStream returns the stream of an apply that creates n resources, whose messages are 1ms apart.
+func applyStream(n int) []byte {
+	t := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	var buf bytes.Buffer
+	for _, msg := range stream.Apply(n, 10) {
+		t = t.Add(time.Millisecond)
+		fmt.Fprintf(&buf, msg+"\n", t.Format(time.RFC3339Nano))
+	}
+	return buf.Bytes()
+}
+
+func BenchmarkUpdate(b *testing.B) {
+	logger, err := log.NewLogger("", "")
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		batchSize int
+		n         int
+	}{
+		// Without batching, the table is rebuilt on every message, so a smaller stream keeps the run practical.
+		{batchSize: 1, n: 500},
+		{batchSize: defaultBatchSize, n: 10000},
+	} {
+		input := applyStream(tt.n)
+		b.Run(fmt.Sprintf("batch=%d/n=%d", tt.batchSize, tt.n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				m := NewRuntimeModel(logger, reader.NewReader(bytes.NewReader(input), io.Discard), time.Time{})
+				m.batchSize = tt.batchSize
+
+				var tm tea.Model = m
+				tm, _ = tm.Update(tea.WindowSizeMsg{Width: 140, Height: 40})
+				for !tm.(UIModel).IsEOF() {
+					tm, _ = tm.Update(tm.(UIModel).nextMessage())
+				}
+				if got := tm.(UIModel).engine.DoneCount(); got != tt.n {
+					b.Fatalf("expect %d operations done, got %d", tt.n, got)
+				}
+				if got := len(tm.(UIModel).engine.OutputInfos()); got != 1 {
+					b.Fatalf("expect 1 output, got %d", got)
+				}
+			}
+		})
+	}
+}
+
+type fakeProcess struct {
+	interrupts, kills int
+}
+
+func (p *fakeProcess) Interrupt() error {
+	p.interrupts++
+	return nil
+}
+
+func (p *fakeProcess) Kill() error {
+	p.kills++
+	return nil
+}
+
+func TestQuitChildProcess(t *testing.T) {
+	logger, err := log.NewLogger("", "")
+	require.NoError(t, err)
+
+	proc := &fakeProcess{}
+	// The stream never reaches EOF, e.g. a grandchild process still holds the pipe.
+	var tm tea.Model = NewRuntimeModel(logger, reader.NewReader(bytes.NewReader(nil), io.Discard), time.Time{}, WithProcess(proc))
+	quit := tea.KeyMsg{Type: tea.KeyCtrlC}
+
+	tm, cmd := tm.Update(quit)
+	require.Nil(t, cmd)
+	require.Equal(t, 1, proc.interrupts)
+
+	tm, cmd = tm.Update(quit)
+	require.Nil(t, cmd)
+	require.Equal(t, 1, proc.kills)
+
+	// No more kill, but quit
+	_, cmd = tm.Update(quit)
+	require.NotNil(t, cmd)
+	require.Equal(t, tea.QuitMsg{}, cmd())
+	require.Equal(t, 1, proc.kills)
+}
+
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+// browseAfterEOF runs the model over the first lines (all if n is negative) of the recorded apply until EOF at the
+// time, then the users browse for an hour, which shouldn't be counted in the exports.
+func browseAfterEOF(t *testing.T, n int, eof time.Time) UIModel {
+	logger, err := log.NewLogger("", "")
+	require.NoError(t, err)
+
+	lines := strings.SplitAfter(string(enginetest.Recording(t, "apply.jsonl")), "\n")
+	if n >= 0 {
+		lines = lines[:n]
+	}
+
+	clk := &fakeClock{now: eof}
+	var tm tea.Model = NewRuntimeModel(logger, reader.NewReader(strings.NewReader(strings.Join(lines, "")), io.Discard), time.Time{}, WithClock(clk))
+	for !tm.(UIModel).IsEOF() {
+		tm, _ = tm.Update(tm.(UIModel).nextMessage())
+	}
+	clk.now = clk.now.Add(time.Hour)
+	return tm.(UIModel)
+}
+
+func TestHTMLEndsAtEOF(t *testing.T) {
+	m := browseAfterEOF(t, -1, time.Date(2025, 1, 10, 10, 0, 20, 0, time.UTC))
+
+	b, err := m.ToHTML()
+	require.NoError(t, err)
+	require.Contains(t, string(b), "<td>Time spent</td><td>19s</td>")
+}
+
+func TestSpansEndAtEOF(t *testing.T) {
+	eof := time.Date(2025, 1, 10, 10, 0, 20, 0, time.UTC)
+	root := browseAfterEOF(t, -1, eof).ToSpans()
+	require.Equal(t, eof, root.End)
+}
+
+func TestTraceEndsAtEOF(t *testing.T) {
+	// The stream ends while random_pet.cat is being created since 10:00:09.
+	m := browseAfterEOF(t, 10, time.Date(2025, 1, 10, 10, 0, 20, 0, time.UTC))
+
+	b, err := m.ToTrace()
+	require.NoError(t, err)
+	type event struct {
+		Name string `json:"name"`
+		Dur  int64  `json:"dur"`
+	}
+	var trace struct {
+		TraceEvents []event `json:"traceEvents"`
+	}
+	require.NoError(t, json.Unmarshal(b, &trace))
+	idx := slices.IndexFunc(trace.TraceEvents, func(ev event) bool { return ev.Name == "create random_pet.cat" })
+	require.NotEqual(t, -1, idx)
+	require.Equal(t, (11 * time.Second).Microseconds(), trace.TraceEvents[idx].Dur)
+}
+
+func TestTimelineCriticalPathCache(t *testing.T) {
+	// The stream ends while random_pet.cat is being created.
+	m := browseAfterEOF(t, 10, time.Date(2025, 1, 10, 10, 0, 20, 0, time.UTC))
+	m.page = PageTimeline
+	m.setPageContent()
+	require.NotNil(t, m.timeline.critical)
+
+	// Mark the cache to tell whether it is recalculated
+	m.timeline.critical[nil] = true
+
+	// A log message doesn't change the operations
+	m.applyMessage(views.LogMsg{BaseMsg: views.BaseMsg{Level: "info", Message: "log"}})
+	m.setPageContent()
+	require.True(t, m.timeline.critical[nil])
+
+	// The running operation grows on tick
+	tm, _ := m.Update(tickMsg(time.Now()))
+	require.NotNil(t, tm.(UIModel).timeline.critical)
+	require.False(t, tm.(UIModel).timeline.critical[nil])
+}
@@ -7,15 +7,26 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"os/exec"
+	"os/signal"
 	"slices"
+	"strconv"
 	"strings"
+	"syscall"
 	"time"
 
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/x/term"
+	"github.com/magodo/pipeform/internal/clock"
+	"github.com/magodo/pipeform/internal/concurrency"
+	"github.com/magodo/pipeform/internal/diag"
+	"github.com/magodo/pipeform/internal/engine"
+	"github.com/magodo/pipeform/internal/history"
 	"github.com/magodo/pipeform/internal/log"
+	"github.com/magodo/pipeform/internal/otlp"
 	"github.com/magodo/pipeform/internal/plainui"
 	"github.com/magodo/pipeform/internal/reader"
+	"github.com/magodo/pipeform/internal/runner"
 	"github.com/magodo/pipeform/internal/ui"
 	"github.com/urfave/cli/v3"
 )
@@ -25,15 +36,44 @@ type FlagSet struct {
 	LogPath  string
 	TeePath  string
 	TimeCsv  string
-	PlainUI  bool
+	// HTMLReport is the path of the HTML report
+	HTMLReport string
+	// TraceJSON is the path of the trace in the Chrome Trace Event format
+	TraceJSON string
+	// OTLP tells whether to export the run as OpenTelemetry spans, which is configured by the OTEL_* env vars
+	OTLP    bool
+	PlainUI bool
+	// StatusInterval is only for the plain UI
+	StatusInterval time.Duration
+	// Parallelism is the -parallelism of terraform, against which the concurrency is analyzed
+	Parallelism int64
+	// HistoryDir is the directory of the timing history, which defaults to history.DefaultDir()
+	HistoryDir string
+	NoHistory  bool
+	// DiagsFormat is the format of the diagnostics printed after the TUI exits, either "human" or "json".
+	DiagsFormat string
+	// MaxMessageSize is in MiB
+	MaxMessageSize int64
+
+	// Command is the terraform command to run in wrap mode, i.e. the arguments after "--".
+	Command []string
+
+	// Only for replay
+	Speed float64
 }
 
 var fset FlagSet
 
+const (
+	diagsFormatHuman = "human"
+	diagsFormatJSON  = "json"
+)
+
 func main() {
 	cmd := &cli.Command{
-		Name:  "pipeform",
-		Usage: "Terraform UI by running like: `terraform ... -json | pipeform`",
+		Name:      "pipeform",
+		Usage:     "Terraform UI by running like: `terraform ... -json | pipeform`, or `pipeform -- terraform ...`",
+		ArgsUsage: "[-- <terraform command>]",
 		Flags: []cli.Flag{
 			&cli.StringFlag{
 				Name:        "log-level",
@@ -66,102 +106,534 @@ func main() {
 				Sources:     cli.EnvVars("PF_TIME_CSV"),
 				Destination: &fset.TimeCsv,
 			},
+			&cli.StringFlag{
+				Name:        "html-report",
+				Usage:       "The self-contained HTML file that reports the run, including the timeline, the planned changes, the diagnostics and the outputs",
+				Sources:     cli.EnvVars("PF_HTML_REPORT"),
+				Destination: &fset.HTMLReport,
+			},
+			&cli.StringFlag{
+				Name:        "trace-json",
+				Usage:       "The JSON file that traces the operations in the Chrome Trace Event format, which can be opened in chrome://tracing or Perfetto",
+				Sources:     cli.EnvVars("PF_TRACE_JSON"),
+				Destination: &fset.TraceJSON,
+			},
+			&cli.BoolFlag{
+				Name:        "otlp",
+				Usage:       "Export the run as OpenTelemetry spans via OTLP/HTTP (http/json), which is configured by the standard OTEL_EXPORTER_OTLP_* environment variables",
+				Sources:     cli.EnvVars("PF_OTLP"),
+				Destination: &fset.OTLP,
+			},
 			&cli.BoolFlag{
 				Name:        "plain-ui",
 				Usage:       "Simply print each log line by line, that expect to use in systems only support plain output",
 				Sources:     cli.EnvVars("PF_PLAIN_UI"),
 				Destination: &fset.PlainUI,
 			},
+			&cli.DurationFlag{
+				Name:        "status-interval",
+				Usage:       "The interval (e.g. 30s) of printing a status line with the progress and the ETA in the plain UI, 0 means never",
+				Sources:     cli.EnvVars("PF_STATUS_INTERVAL"),
+				Destination: &fset.StatusInterval,
+				Validator: func(input time.Duration) error {
+					if input < 0 {
+						return fmt.Errorf("status interval must not be negative: %s", input)
+					}
+					return nil
+				},
+			},
+			&cli.IntFlag{
+				Name:        "parallelism",
+				Usage:       "The -parallelism of terraform, against which the concurrency is analyzed. In wrap mode, it defaults to the one of the terraform command",
+				Sources:     cli.EnvVars("PF_PARALLELISM"),
+				Value:       concurrency.DefaultParallelism,
+				Destination: &fset.Parallelism,
+				Validator: func(input int64) error {
+					if input <= 0 {
+						return fmt.Errorf("parallelism must be positive: %d", input)
+					}
+					return nil
+				},
+			},
+			&cli.StringFlag{
+				Name:        "history-dir",
+				Usage:       "The directory of the timing history of the past runs, which is kept per working directory, defaults to $XDG_DATA_HOME/pipeform",
+				Sources:     cli.EnvVars("PF_HISTORY_DIR"),
+				Destination: &fset.HistoryDir,
+			},
+			&cli.BoolFlag{
+				Name:        "no-history",
+				Usage:       "Neither expect the durations of the operations from the timing history, nor record this run into it",
+				Sources:     cli.EnvVars("PF_NO_HISTORY"),
+				Destination: &fset.NoHistory,
+			},
+			&cli.StringFlag{
+				Name:        "diags-format",
+				Usage:       `The format of the diagnostics printed after the TUI exits, either "human" or "json"`,
+				Sources:     cli.EnvVars("PF_DIAGS_FORMAT"),
+				Value:       diagsFormatHuman,
+				Destination: &fset.DiagsFormat,
+				Validator: func(input string) error {
+					if input != diagsFormatHuman && input != diagsFormatJSON {
+						return fmt.Errorf("invalid diagnostics format: %s", input)
+					}
+					return nil
+				},
+			},
+			&cli.IntFlag{
+				Name:        "max-message-size",
+				Usage:       "The maximum size (in MiB) of a single message in the stream, a larger message is skipped with a warning",
+				Sources:     cli.EnvVars("PF_MAX_MESSAGE_SIZE"),
+				Value:       reader.DefaultMaxMessageSize / 1024 / 1024,
+				Destination: &fset.MaxMessageSize,
+				Validator: func(input int64) error {
+					if input <= 0 {
+						return fmt.Errorf("max message size must be positive: %d", input)
+					}
+					return nil
+				},
+			},
 		},
-		Before: func(ctx context.Context, c *cli.Command) (context.Context, error) {
-			// If this program starts in standalone, its stdin is the same as the terminal.
-			// bubbletea will change the terminal into raw mode and read ansi events from it,
-			// which conflicts with the stdin reading for terraform JSON streams.
-			// In this case, user's input (e.g. ctrl-c keypress) will most likely be accidently read by
-			// the stream reader, instead of the ansi read loop (by bubbletea), causing a lost of event.
-			if term.IsTerminal(os.Stdin.Fd()) {
-				return ctx, errors.New("Must be followed by a pipe")
-			}
-			return ctx, nil
+		Action: runAction,
+		Commands: []*cli.Command{
+			{
+				Name:      "replay",
+				Usage:     "Replay a stream recorded by --tee, with its original timing",
+				ArgsUsage: "<file>",
+				Flags: []cli.Flag{
+					&cli.FloatFlag{
+						Name:        "speed",
+						Usage:       "The multiplier of the replay speed",
+						Value:       1,
+						Destination: &fset.Speed,
+						Validator: func(input float64) error {
+							if input <= 0 {
+								return fmt.Errorf("speed must be positive: %v", input)
+							}
+							return nil
+						},
+					},
+				},
+				Action: replayAction,
+			},
+			{
+				Name:      "view",
+				Usage:     "View a stream recorded by --tee in its final state",
+				ArgsUsage: "<file>",
+				Action:    viewAction,
+			},
 		},
-		Action: func(context.Context, *cli.Command) error {
-			startTime := time.Now()
+	}
 
-			logger, err := log.NewLogger(log.Level(fset.LogLevel), fset.LogPath)
-			if err != nil {
-				fmt.Println(err)
-				os.Exit(1)
-			}
-			defer logger.Close()
+	// The arguments after "--" are the terraform command to run. They are split out beforehand, as
+	// the cli would otherwise try to parse the flags of the terraform command (e.g. -auto-approve).
+	args := os.Args
+	if i := slices.Index(args, "--"); i != -1 {
+		args, fset.Command = args[:i], args[i+1:]
+	}
 
-			teeWriter := io.Discard
-			if path := fset.TeePath; path != "" {
-				f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
-				if err != nil {
-					return fmt.Errorf("open for tee: %v", err)
+	if err := cmd.Run(context.Background(), args); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func runAction(ctx context.Context, c *cli.Command) error {
+	// If this program starts in standalone, its stdin is the same as the terminal.
+	// bubbletea will change the terminal into raw mode and read ansi events from it,
+	// which conflicts with the stdin reading for terraform JSON streams.
+	// In this case, user's input (e.g. ctrl-c keypress) will most likely be accidently read by
+	// the stream reader, instead of the ansi read loop (by bubbletea), causing a lost of event.
+	// This doesn't apply to the wrap mode, where the stream is read from the child process.
+	if len(fset.Command) == 0 && term.IsTerminal(os.Stdin.Fd()) {
+		return errors.New("Must be followed by a pipe")
+	}
+
+	startTime := time.Now()
+
+	logger, err := log.NewLogger(log.Level(fset.LogLevel), fset.LogPath)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	defer logger.Close()
+
+	teeWriter := io.Discard
+	if path := fset.TeePath; path != "" {
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+		if err != nil {
+			return fmt.Errorf("open for tee: %v", err)
+		}
+		teeWriter = f
+		defer f.Close()
+	}
+
+	if n, ok := terraformParallelism(fset.Command); ok && !c.IsSet("parallelism") {
+		fset.Parallelism = int64(n)
+	}
+
+	// The history and the OTLP config are loaded before starting the child process or reading the pipe, as nothing
+	// should stop the run once terraform is running.
+	otlpConfig, err := loadOTLPConfig()
+	if err != nil {
+		return err
+	}
+	hist := loadHistory()
+
+	var input io.Reader = os.Stdin
+
+	// In wrap mode, launch the terraform command as a child process, and read from its stdout.
+	var child *runner.Runner
+	if args := fset.Command; len(args) != 0 {
+		// The plain UI doesn't take over the terminal, so the stderr is passed through.
+		// Otherwise, the stderr is buffered and printed after the TUI exits.
+		var stderr io.Writer
+		if fset.PlainUI {
+			stderr = os.Stderr
+		}
+		child, err = runner.New(args, stderr)
+		if err != nil {
+			return err
+		}
+		logger.Info("Starting child process", "args", child.Args())
+		if input, err = child.Start(); err != nil {
+			return fmt.Errorf("starting %q: %v", args[0], err)
+		}
+
+		// Forward the signals to the child process.
+		sigCh := make(chan os.Signal, 1)
+		signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
+		defer signal.Stop(sigCh)
+		go func() {
+			for sig := range sigCh {
+				logger.Warn("Forwarding signal to the child process", "signal", sig)
+				if err := child.Signal(sig); err != nil {
+					logger.Error("Forwarding signal", "error", err)
 				}
-				teeWriter = f
-				defer f.Close()
 			}
+		}()
+	}
 
-			reader := reader.NewReader(os.Stdin, teeWriter)
+	reader := reader.NewReader(input, teeWriter, reader.WithMaxMessageSize(int(fset.MaxMessageSize)*1024*1024))
 
-			type Model interface {
-				ToCsv() []byte
-				IsEOF() bool
-			}
+	model, err := runModel(logger, reader, startTime, runOptions{child: child, history: hist})
+	if err != nil {
+		return err
+	}
 
-			var model Model
+	if err := writeTimeCsv(model); err != nil {
+		return err
+	}
 
-			if fset.PlainUI {
-				m := plainui.NewRuntimeModel(logger, reader, os.Stdout, startTime)
-				if err := m.Run(); err != nil {
-					return fmt.Errorf("Error running program: %v\n", err)
-				}
+	if err := writeHTMLReport(model); err != nil {
+		return err
+	}
+	if err := writeTraceJSON(model); err != nil {
+		return err
+	}
+	exportSpans(ctx, otlpConfig, model)
 
-				model = m
-			} else {
-				m := ui.NewRuntimeModel(logger, reader, startTime)
-				tm, err := tea.NewProgram(m, tea.WithInputTTY(), tea.WithAltScreen()).Run()
-				if err != nil {
-					return fmt.Errorf("Error running program: %v\n", err)
-				}
+	// Only the live runs that reach EOF are recorded, the replays of them would otherwise be recorded repeatedly.
+	if hist != nil && model.IsEOF() {
+		if err := hist.Ingest(model.ToCsv()); err != nil {
+			fmt.Fprintf(os.Stderr, "recording timing history: %v\n", err)
+		} else if err := hist.Save(); err != nil {
+			fmt.Fprintf(os.Stderr, "saving timing history: %v\n", err)
+		}
+	}
 
-				m = tm.(ui.UIModel)
+	if !model.IsEOF() {
+		if child != nil {
+			child.Kill()
+		}
+		fmt.Fprintln(os.Stderr, "Interrupted!")
+		os.Exit(1)
+	}
 
-				// Print diags
-				for _, diag := range m.Diags() {
-					if b, err := json.MarshalIndent(diag, "", "  "); err == nil {
-						fmt.Fprintln(os.Stderr, string(b))
-					}
+	// Exit with the same code as the child process.
+	if child != nil {
+		if err := child.Wait(); err != nil {
+			var exitErr *exec.ExitError
+			if errors.As(err, &exitErr) {
+				code := exitErr.ExitCode()
+				// Terminated by a signal
+				if code < 0 {
+					code = 1
 				}
-
-				model = m
+				os.Exit(code)
 			}
+			return fmt.Errorf("waiting for %q: %v", child.Args()[0], err)
+		}
+	}
 
-			if path := fset.TimeCsv; path != "" {
-				f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
-				if err != nil {
-					return fmt.Errorf("open time csv file: %v", err)
-				}
-				defer f.Close()
+	return nil
+}
 
-				if _, err := f.Write(model.ToCsv()); err != nil {
-					fmt.Fprintf(os.Stderr, "writing time csv file: %v", err)
-				}
+func replayAction(ctx context.Context, c *cli.Command) error {
+	return replay(ctx, c, fset.Speed)
+}
+
+func viewAction(ctx context.Context, c *cli.Command) error {
+	// Consume the whole stream without any delay, the durations are derived from the recorded timestamps.
+	return replay(ctx, c, 0)
+}
+
+// replay replays the recorded stream file with the speed multiplier. A non-positive speed means no delay.
+func replay(ctx context.Context, c *cli.Command, speed float64) error {
+	if c.NArg() != 1 {
+		return errors.New("exactly one recorded stream file is expected")
+	}
+
+	logger, err := log.NewLogger(log.Level(fset.LogLevel), fset.LogPath)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	defer logger.Close()
+
+	f, err := os.Open(c.Args().First())
+	if err != nil {
+		return fmt.Errorf("open recorded stream: %v", err)
+	}
+	defer f.Close()
+
+	replayer := reader.NewReplayer(reader.NewReader(f, io.Discard, reader.WithMaxMessageSize(int(fset.MaxMessageSize)*1024*1024)), speed)
+
+	hist := loadHistory()
+
+	otlpConfig, err := loadOTLPConfig()
+	if err != nil {
+		return err
+	}
+
+	opt := runOptions{clock: replayer, history: hist}
+	if speed > 0 {
+		opt.player = replayer
+	}
+
+	// The start time is decided by the first message of the recorded stream.
+	model, err := runModel(logger, replayer, time.Time{}, opt)
+	if err != nil {
+		return err
+	}
+
+	if err := writeTimeCsv(model); err != nil {
+		return err
+	}
+
+	if err := writeHTMLReport(model); err != nil {
+		return err
+	}
+	if err := writeTraceJSON(model); err != nil {
+		return err
+	}
+	exportSpans(ctx, otlpConfig, model)
+	return nil
+}
+
+type Model interface {
+	ToCsv() []byte
+	ToHTML() ([]byte, error)
+	ToTrace() ([]byte, error)
+	ToSpans() *otlp.Span
+	IsEOF() bool
+}
+
+type runOptions struct {
+	// clock defaults to the wall clock
+	clock clock.Clock
+	// child is only set in wrap mode
+	child *runner.Runner
+	// player is only set in replay
+	player ui.Player
+	// history is nil if disabled
+	history *history.History
+}
+
+// runModel runs either the plain UI or the TUI, until the stream reaches EOF (or the user quits for TUI).
+func runModel(logger *log.Logger, reader reader.MessageReader, startTime time.Time, opt runOptions) (Model, error) {
+	if opt.clock == nil {
+		opt.clock = clock.Real()
+	}
+
+	if fset.PlainUI {
+		m := plainui.NewRuntimeModel(logger, reader, os.Stdout, startTime, plainui.WithClock(opt.clock), plainui.WithStatusInterval(fset.StatusInterval), plainui.WithHistory(opt.history), plainui.WithParallelism(int(fset.Parallelism)))
+		if err := m.Run(); err != nil {
+			return nil, fmt.Errorf("Error running program: %v\n", err)
+		}
+		return m, nil
+	}
+
+	opts := []ui.Option{ui.WithClock(opt.clock), ui.WithHistory(opt.history), ui.WithParallelism(int(fset.Parallelism))}
+	if opt.child != nil {
+		opts = append(opts, ui.WithProcess(opt.child))
+	}
+	if opt.player != nil {
+		opts = append(opts, ui.WithPlayer(opt.player))
+	}
+	m := ui.NewRuntimeModel(logger, reader, startTime, opts...)
+	tm, err := tea.NewProgram(m, tea.WithInputTTY(), tea.WithAltScreen()).Run()
+	if err != nil {
+		return nil, fmt.Errorf("Error running program: %v\n", err)
+	}
+
+	m = tm.(ui.UIModel)
+
+	if opt.child != nil {
+		os.Stderr.Write(opt.child.Stderr())
+	}
+
+	printDiags(m.Diags())
+
+	return m, nil
+}
+
+// printDiags prints the diagnostics to the stderr in the format specified by --diags-format.
+func printDiags(diags engine.Diags) {
+	if len(diags) == 0 {
+		return
+	}
+
+	if fset.DiagsFormat == diagsFormatJSON {
+		for _, diag := range diags {
+			if b, err := json.MarshalIndent(diag, "", "  "); err == nil {
+				fmt.Fprintln(os.Stderr, string(b))
 			}
+		}
+		return
+	}
+
+	// Only colorize and wrap for a terminal, e.g. not for a CI log.
+	var opts []diag.Option
+	if fd := os.Stderr.Fd(); term.IsTerminal(fd) {
+		opts = append(opts, diag.WithColor(true))
+		if width, _, err := term.GetSize(fd); err == nil {
+			opts = append(opts, diag.WithWidth(width))
+		}
+	}
+	fmt.Fprintln(os.Stderr, diag.RenderAll(diags, opts...))
+}
 
-			if !model.IsEOF() {
-				fmt.Fprintln(os.Stderr, "Interrupted!")
-				os.Exit(1)
+// terraformParallelism returns the value of the -parallelism option of the terraform command, if specified.
+func terraformParallelism(args []string) (int, bool) {
+	for i, arg := range args {
+		name, value, hasValue := strings.Cut(strings.TrimPrefix(arg, "-"), "=")
+		if name != "-parallelism" && name != "parallelism" {
+			continue
+		}
+		if !hasValue {
+			if i+1 >= len(args) {
+				return 0, false
 			}
+			value = args[i+1]
+		}
+		n, err := strconv.Atoi(value)
+		if err != nil || n <= 0 {
+			return 0, false
+		}
+		return n, true
+	}
+	return 0, false
+}
 
+// loadHistory loads the timing history specified by --history-dir, it returns nil if --no-history is set.
+// As the history is optional, a failure is only warned, and the history is disabled as if --no-history is set.
+func loadHistory() *history.History {
+	if fset.NoHistory {
+		return nil
+	}
+	dir := fset.HistoryDir
+	if dir == "" {
+		var err error
+		if dir, err = history.DefaultDir(); err != nil {
+			fmt.Fprintf(os.Stderr, "locating timing history, disabled: %v\n", err)
 			return nil
-		},
+		}
 	}
+	// The history is kept per project, i.e. the working directory
+	project, err := os.Getwd()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "locating timing history, disabled: %v\n", err)
+		return nil
+	}
+	hist, err := history.Load(dir, project)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "loading timing history, disabled: %v\n", err)
+		return nil
+	}
+	return hist
+}
 
-	if err := cmd.Run(context.Background(), os.Args); err != nil {
-		fmt.Fprintln(os.Stderr, err)
-		os.Exit(1)
+// loadOTLPConfig returns the config of the OpenTelemetry exporter, or nil if disabled. The config is read before
+// the run, so that a misconfiguration fails fast.
+func loadOTLPConfig() (*otlp.Config, error) {
+	if !fset.OTLP {
+		return nil, nil
+	}
+	cfg, err := otlp.ConfigFromEnv(os.Getenv)
+	if err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
+
+// exportSpans exports the run as OpenTelemetry spans, if enabled. A failure is only warned, as it shouldn't fail
+// the run itself.
+func exportSpans(ctx context.Context, cfg *otlp.Config, model Model) {
+	if cfg == nil {
+		return
+	}
+	if err := otlp.Export(ctx, *cfg, model.ToSpans()); err != nil {
+		fmt.Fprintf(os.Stderr, "exporting OpenTelemetry spans: %v\n", err)
+	}
+}
+
+func writeTimeCsv(model Model) error {
+	path := fset.TimeCsv
+	if path == "" {
+		return nil
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return fmt.Errorf("open time csv file: %v", err)
+	}
+	defer f.Close()
+
+	if _, err := f.Write(model.ToCsv()); err != nil {
+		fmt.Fprintf(os.Stderr, "writing time csv file: %v", err)
+	}
+	return nil
+}
+
+func writeHTMLReport(model Model) error {
+	path := fset.HTMLReport
+	if path == "" {
+		return nil
+	}
+
+	b, err := model.ToHTML()
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, b, 0644); err != nil {
+		return fmt.Errorf("writing HTML report: %v", err)
+	}
+	return nil
+}
+
+func writeTraceJSON(model Model) error {
+	path := fset.TraceJSON
+	if path == "" {
+		return nil
+	}
+
+	b, err := model.ToTrace()
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, b, 0644); err != nil {
+		return fmt.Errorf("writing trace: %v", err)
 	}
+	return nil
 }
@@ -0,0 +1,144 @@
+package views
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+)
+
+// DefaultMaxMessageSize is the default maximum size of a single message (i.e. a line) in the stream.
+const DefaultMaxMessageSize = 64 * 1024 * 1024
+
+// UnknownTypeHandler handles a message whose type is unknown to this package, e.g. one added by a newer Terraform.
+// Returning a nil message skips the line, and returning an error results in a LineError.
+type UnknownTypeHandler func(msg UnknownMsg) (Message, error)
+
+// LineError is returned by the Decoder for a line that can't be decoded as a message, e.g. a line that isn't JSON.
+// The decoding can continue after it.
+type LineError struct {
+	Line []byte
+	Err  error
+}
+
+func (e *LineError) Error() string {
+	return fmt.Sprintf("decoding line %q: %v", e.Line, e.Err)
+}
+
+func (e *LineError) Unwrap() error {
+	return e.Err
+}
+
+// MessageTooLargeError is returned by the Decoder for a line that exceeds the maximum message size.
+// The line is skipped, and the decoding can continue after it.
+type MessageTooLargeError struct {
+	Size int
+	Max  int
+}
+
+func (e *MessageTooLargeError) Error() string {
+	return fmt.Sprintf("a message of %d bytes exceeds the maximum message size of %d bytes", e.Size, e.Max)
+}
+
+// Decoder decodes the messages from a machine-readable UI stream (e.g. `terraform apply -json`), one message per line.
+// Each line is read in chunks, so there is no limit on the line length other than the max message size,
+// which guards the memory usage.
+type Decoder struct {
+	br             *bufio.Reader
+	maxMessageSize int
+	unknownHandler UnknownTypeHandler
+}
+
+type DecoderOption func(*Decoder)
+
+// WithMaxMessageSize sets the maximum size of a single message, which defaults to DefaultMaxMessageSize.
+func WithMaxMessageSize(size int) DecoderOption {
+	return func(d *Decoder) {
+		d.maxMessageSize = size
+	}
+}
+
+// WithUnknownTypeHandler sets the handler of the messages whose type is unknown.
+// Without it, such a message is returned as an UnknownMsg.
+func WithUnknownTypeHandler(h UnknownTypeHandler) DecoderOption {
+	return func(d *Decoder) {
+		d.unknownHandler = h
+	}
+}
+
+func NewDecoder(r io.Reader, opts ...DecoderOption) *Decoder {
+	d := &Decoder{
+		br:             bufio.NewReader(r),
+		maxMessageSize: DefaultMaxMessageSize,
+	}
+	for _, opt := range opts {
+		opt(d)
+	}
+	return d
+}
+
+// Decode returns the next message, the blank lines are skipped.
+// A line that can't be decoded results in a LineError, and an oversized line results in a MessageTooLargeError,
+// the decoding can continue after both. At the end of the stream, io.EOF is returned.
+func (d *Decoder) Decode() (Message, error) {
+	for {
+		line, size, err := d.readLine()
+		if err != nil {
+			return nil, err
+		}
+		if size > d.maxMessageSize {
+			return nil, &MessageTooLargeError{Size: size, Max: d.maxMessageSize}
+		}
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		msg, err := UnmarshalMessage(line)
+		if err != nil {
+			return nil, &LineError{Line: line, Err: err}
+		}
+		if unknown, ok := msg.(UnknownMsg); ok && d.unknownHandler != nil {
+			msg, err = d.unknownHandler(unknown)
+			if err != nil {
+				return nil, &LineError{Line: line, Err: err}
+			}
+			if msg == nil {
+				continue
+			}
+		}
+		return msg, nil
+	}
+}
+
+// readLine reads the next line without the line ending, together with its size. In case the size exceeds the
+// max message size, the line is read through but not kept.
+func (d *Decoder) readLine() (line []byte, size int, err error) {
+	for {
+		chunk, err := d.br.ReadSlice('\n')
+
+		content := chunk
+		if err != bufio.ErrBufferFull {
+			content = bytes.TrimRight(chunk, "\r\n")
+		}
+		size += len(content)
+		if size <= d.maxMessageSize {
+			line = append(line, content...)
+		} else {
+			line = nil
+		}
+
+		switch err {
+		case nil:
+			return line, size, nil
+		case bufio.ErrBufferFull:
+			continue
+		case io.EOF:
+			// The last line doesn't end with a newline
+			if len(chunk) != 0 {
+				return line, size, nil
+			}
+			return nil, 0, io.EOF
+		default:
+			return nil, 0, err
+		}
+	}
+}
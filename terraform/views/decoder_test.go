@@ -0,0 +1,104 @@
+package views_test
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/magodo/pipeform/terraform/views"
+	"github.com/magodo/pipeform/terraform/views/json"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecoder(t *testing.T) {
+	inputs := []string{
+		`{"@level":"info","@message":"random_pet.dog: Creating...","@module":"terraform.ui","@timestamp":"2025-01-10T10:00:00Z","hook":{"resource":{"addr":"random_pet.dog","module":"","resource":"random_pet.dog","implied_provider":"random","resource_type":"random_pet","resource_name":"dog","resource_key":null},"action":"create"},"type":"apply_start"}`,
+		``,
+		`not a json`,
+		`{"@level":"info","@message":"Something new","@module":"terraform.ui","@timestamp":"2025-01-10T10:00:01Z","type":"something_new"}`,
+		`{"foo":1}`,
+		`{"@level":"info","@message":"` + strings.Repeat("x", 1024) + `","@module":"terraform.ui","@timestamp":"2025-01-10T10:00:02Z","type":"log"}`,
+		`{"@level":"info","@message":"last line","@module":"terraform.ui","@timestamp":"2025-01-10T10:00:03Z","type":"log"}`,
+	}
+	stream := strings.Join(inputs, "\n")
+
+	dec := views.NewDecoder(strings.NewReader(stream), views.WithMaxMessageSize(512))
+
+	msg, err := dec.Decode()
+	require.NoError(t, err)
+	hook, ok := msg.(views.HookMsg)
+	require.True(t, ok)
+	start, ok := hook.OperationStart()
+	require.True(t, ok)
+	require.Equal(t, "random_pet.dog", start.Resource.Addr)
+	_, ok = hook.OperationComplete()
+	require.False(t, ok)
+
+	// The blank line is skipped
+	_, err = dec.Decode()
+	var lineErr *views.LineError
+	require.True(t, errors.As(err, &lineErr))
+	require.Equal(t, inputs[2], string(lineErr.Line))
+
+	msg, err = dec.Decode()
+	require.NoError(t, err)
+	unknown, ok := msg.(views.UnknownMsg)
+	require.True(t, ok)
+	require.Equal(t, json.MessageType("something_new"), unknown.Type)
+	require.Equal(t, "Something new", unknown.Message)
+	require.JSONEq(t, inputs[3], string(unknown.Raw))
+
+	// The JSON without a type isn't a Terraform message, but a raw line
+	msg, err = dec.Decode()
+	require.NoError(t, err)
+	require.Equal(t, views.NewRawLineMsg(inputs[4]), msg)
+
+	_, err = dec.Decode()
+	var sizeErr *views.MessageTooLargeError
+	require.True(t, errors.As(err, &sizeErr))
+	require.Equal(t, len(inputs[5]), sizeErr.Size)
+
+	// The last line without a trailing newline
+	msg, err = dec.Decode()
+	require.NoError(t, err)
+	require.Equal(t, "last line", msg.BaseMessage().Message)
+
+	_, err = dec.Decode()
+	require.Equal(t, io.EOF, err)
+}
+
+func TestDecoderUnknownTypeHandler(t *testing.T) {
+	inputs := []string{
+		`{"@level":"info","@message":"Something new","@module":"terraform.ui","@timestamp":"2025-01-10T10:00:01Z","type":"something_new"}`,
+		`{"foo":1}`,
+		`{"@level":"info","@message":"Something skipped","@module":"terraform.ui","@timestamp":"2025-01-10T10:00:02Z","type":"something_skipped"}`,
+		`{"@level":"info","@message":"Something failed","@module":"terraform.ui","@timestamp":"2025-01-10T10:00:03Z","type":"something_failed"}`,
+	}
+
+	handlerErr := errors.New("failed")
+	dec := views.NewDecoder(strings.NewReader(strings.Join(inputs, "\n")), views.WithUnknownTypeHandler(func(msg views.UnknownMsg) (views.Message, error) {
+		switch msg.Type {
+		case "something_skipped":
+			return nil, nil
+		case "something_failed":
+			return nil, handlerErr
+		}
+		return msg.BaseMsg, nil
+	}))
+
+	msg, err := dec.Decode()
+	require.NoError(t, err)
+	require.Equal(t, "Something new", msg.BaseMessage().Message)
+
+	// The JSON without a type doesn't reach the handler
+	msg, err = dec.Decode()
+	require.NoError(t, err)
+	require.Equal(t, views.NewRawLineMsg(inputs[1]), msg)
+
+	_, err = dec.Decode()
+	require.ErrorIs(t, err, handlerErr)
+
+	_, err = dec.Decode()
+	require.Equal(t, io.EOF, err)
+}
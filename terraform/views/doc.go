@@ -0,0 +1,34 @@
+// Package views parses the machine-readable UI stream of Terraform (and OpenTofu), i.e. the output of
+// commands like `terraform apply -json` or `terraform test -json`.
+//
+// A stream is decoded message by message with the Decoder:
+//
+//	dec := views.NewDecoder(os.Stdin)
+//	for {
+//		msg, err := dec.Decode()
+//		if err == io.EOF {
+//			break
+//		}
+//		if err != nil {
+//			// A *LineError or *MessageTooLargeError only affects the current line.
+//			continue
+//		}
+//		if hook, ok := msg.(views.HookMsg); ok {
+//			if start, ok := hook.OperationStart(); ok {
+//				fmt.Println(start.Resource.Addr, start.Action)
+//			}
+//		}
+//	}
+//
+// Each message is one of the *Msg types of this package, whose payloads are defined in the json package.
+// A message of an unknown type (e.g. added by a newer Terraform) is returned as an UnknownMsg, which can be
+// customized by WithUnknownTypeHandler. SupportedUIVersion tells the UI protocol version this package is built for.
+//
+// # Versioning
+//
+// This package, together with the json package, is versioned with the pipeform module following the semantic
+// versioning. From v1 on, the exported identifiers are not removed or changed incompatibly within a major version.
+// Before v1, an incompatible change only happens in a minor version, and is called out in the release notes.
+// New message types, and new fields of the existing types, can be added in any minor version as Terraform evolves
+// its UI protocol, so consumers are expected to tolerate the messages they don't handle.
+package views
@@ -0,0 +1,65 @@
+package views
+
+import "github.com/magodo/pipeform/terraform/views/json"
+
+// The typed accessors of the hook of a HookMsg, each returns false if the hook is of another type.
+
+// OperationStart returns the hook of the apply_start or ephemeral_op_start message.
+func (m HookMsg) OperationStart() (json.OperationStart, bool) {
+	h, ok := m.Hook.(json.OperationStart)
+	return h, ok
+}
+
+// OperationProgress returns the hook of the apply_progress or ephemeral_op_progress message.
+func (m HookMsg) OperationProgress() (json.OperationProgress, bool) {
+	h, ok := m.Hook.(json.OperationProgress)
+	return h, ok
+}
+
+// OperationComplete returns the hook of the apply_complete or ephemeral_op_complete message.
+func (m HookMsg) OperationComplete() (json.OperationComplete, bool) {
+	h, ok := m.Hook.(json.OperationComplete)
+	return h, ok
+}
+
+// OperationErrored returns the hook of the apply_errored or ephemeral_op_errored message.
+func (m HookMsg) OperationErrored() (json.OperationErrored, bool) {
+	h, ok := m.Hook.(json.OperationErrored)
+	return h, ok
+}
+
+// ProvisionStart returns the hook of the provision_start message.
+func (m HookMsg) ProvisionStart() (json.ProvisionStart, bool) {
+	h, ok := m.Hook.(json.ProvisionStart)
+	return h, ok
+}
+
+// ProvisionProgress returns the hook of the provision_progress message.
+func (m HookMsg) ProvisionProgress() (json.ProvisionProgress, bool) {
+	h, ok := m.Hook.(json.ProvisionProgress)
+	return h, ok
+}
+
+// ProvisionComplete returns the hook of the provision_complete message.
+func (m HookMsg) ProvisionComplete() (json.ProvisionComplete, bool) {
+	h, ok := m.Hook.(json.ProvisionComplete)
+	return h, ok
+}
+
+// ProvisionErrored returns the hook of the provision_errored message.
+func (m HookMsg) ProvisionErrored() (json.ProvisionErrored, bool) {
+	h, ok := m.Hook.(json.ProvisionErrored)
+	return h, ok
+}
+
+// RefreshStart returns the hook of the refresh_start message.
+func (m HookMsg) RefreshStart() (json.RefreshStart, bool) {
+	h, ok := m.Hook.(json.RefreshStart)
+	return h, ok
+}
+
+// RefreshComplete returns the hook of the refresh_complete message.
+func (m HookMsg) RefreshComplete() (json.RefreshComplete, bool) {
+	h, ok := m.Hook.(json.RefreshComplete)
+	return h, ok
+}
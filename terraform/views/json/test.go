@@ -0,0 +1,61 @@
+package json
+
+// TestSuiteAbstract maps the test file path to the names of its run blocks.
+type TestSuiteAbstract map[string][]string
+
+type TestStatus string
+
+const (
+	TestPending TestStatus = "pending"
+	TestSkip    TestStatus = "skip"
+	TestPass    TestStatus = "pass"
+	TestFail    TestStatus = "fail"
+	TestError   TestStatus = "error"
+)
+
+type TestProgress string
+
+const (
+	TestStarting TestProgress = "starting"
+	TestRunning  TestProgress = "running"
+	TestTearDown TestProgress = "teardown"
+	TestComplete TestProgress = "complete"
+)
+
+type TestSuiteSummary struct {
+	Status  TestStatus `json:"status"`
+	Passed  int        `json:"passed"`
+	Errored int        `json:"errored"`
+	Failed  int        `json:"failed"`
+	Skipped int        `json:"skipped"`
+}
+
+type TestFileStatus struct {
+	Path     string       `json:"path"`
+	Progress TestProgress `json:"progress"`
+	Status   TestStatus   `json:"status,omitempty"`
+}
+
+type TestRunStatus struct {
+	Path     string       `json:"path"`
+	Run      string       `json:"run"`
+	Progress TestProgress `json:"progress"`
+	// Elapsed is in milliseconds
+	Elapsed *int64     `json:"elapsed,omitempty"`
+	Status  TestStatus `json:"status,omitempty"`
+}
+
+type TestFileCleanup struct {
+	FailedResources []TestFailedResource `json:"failed_resources,omitempty"`
+}
+
+type TestFailedResource struct {
+	Instance   string `json:"instance"`
+	DeposedKey string `json:"deposed_key,omitempty"`
+}
+
+type TestFatalInterrupt struct {
+	State   []TestFailedResource            `json:"state,omitempty"`
+	States  map[string][]TestFailedResource `json:"states,omitempty"`
+	Planned []string                        `json:"planned,omitempty"`
+}
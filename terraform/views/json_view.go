@@ -1,12 +1,11 @@
 package views
 
 import (
-	"fmt"
 	"time"
 
 	gojson "encoding/json"
 
-	"github.com/magodo/pipeform/internal/terraform/views/json"
+	"github.com/magodo/pipeform/terraform/views/json"
 )
 
 type Message interface {
@@ -121,6 +120,41 @@ func (m HookMsg) BaseMessage() BaseMsg {
 	return m.BaseMsg
 }
 
+// MessageRawLine is not defined by Terraform, but by pipeform for the RawLineMsg.
+const MessageRawLine json.MessageType = "raw_line"
+
+// RawLineMsg represents a line in the stream that isn't a valid Terraform message, e.g. the outputs of a wrapper script
+// (like atmos), or a provider's panic trace. The line is kept as is in the Message.
+type RawLineMsg struct {
+	BaseMsg
+}
+
+func NewRawLineMsg(line string) RawLineMsg {
+	return RawLineMsg{
+		BaseMsg: BaseMsg{
+			Message: line,
+			Type:    MessageRawLine,
+		},
+	}
+}
+
+func (m RawLineMsg) BaseMessage() BaseMsg {
+	return m.BaseMsg
+}
+
+// UnknownMsg represents a message whose type is unknown to this package, e.g. added by a newer Terraform.
+type UnknownMsg struct {
+	BaseMsg
+	// Raw is the whole message
+	Raw gojson.RawMessage
+}
+
+func (m UnknownMsg) BaseMessage() BaseMsg {
+	return m.BaseMsg
+}
+
+// UnmarshalMessage unmarshals a single message. A message whose type is unknown is returned as an UnknownMsg, while a
+// JSON without the type (e.g. a wrapper's own JSON log) isn't a Terraform message, which is returned as a RawLineMsg.
 func UnmarshalMessage(b []byte) (Message, error) {
 	var baseMsg BaseMsg
 	if err := gojson.Unmarshal(b, &baseMsg); err != nil {
@@ -337,7 +371,83 @@ func UnmarshalMessage(b []byte) (Message, error) {
 			Hook:    temp.RefreshComplete,
 		}, nil
 
+	case json.MessageTestAbstract:
+		var msg TestAbstractMsg
+		if err := gojson.Unmarshal(b, &msg); err != nil {
+			return nil, err
+		}
+		return msg, nil
+
+	case json.MessageTestFile:
+		var msg TestFileMsg
+		if err := gojson.Unmarshal(b, &msg); err != nil {
+			return nil, err
+		}
+		return msg, nil
+
+	case json.MessageTestRun:
+		var msg TestRunMsg
+		if err := gojson.Unmarshal(b, &msg); err != nil {
+			return nil, err
+		}
+		return msg, nil
+
+	case json.MessageTestPlan:
+		var msg TestPlanMsg
+		if err := gojson.Unmarshal(b, &msg); err != nil {
+			return nil, err
+		}
+		return msg, nil
+
+	case json.MessageTestState:
+		var msg TestStateMsg
+		if err := gojson.Unmarshal(b, &msg); err != nil {
+			return nil, err
+		}
+		return msg, nil
+
+	case json.MessageTestSummary:
+		var msg TestSummaryMsg
+		if err := gojson.Unmarshal(b, &msg); err != nil {
+			return nil, err
+		}
+		return msg, nil
+
+	case json.MessageTestCleanup:
+		var msg TestCleanupMsg
+		if err := gojson.Unmarshal(b, &msg); err != nil {
+			return nil, err
+		}
+		return msg, nil
+
+	case json.MessageTestInterrupt:
+		var msg TestInterruptMsg
+		if err := gojson.Unmarshal(b, &msg); err != nil {
+			return nil, err
+		}
+		return msg, nil
+
+	case json.MessageTestStatus:
+		var msg TestStatusMsg
+		if err := gojson.Unmarshal(b, &msg); err != nil {
+			return nil, err
+		}
+		return msg, nil
+
+	case json.MessageTestRetry:
+		var msg TestRetryMsg
+		if err := gojson.Unmarshal(b, &msg); err != nil {
+			return nil, err
+		}
+		return msg, nil
+
+	case "":
+		return NewRawLineMsg(string(b)), nil
+
 	default:
-		return nil, fmt.Errorf("unhandled message type: %s", baseMsg.Type)
+		return UnknownMsg{
+			BaseMsg: baseMsg,
+			Raw:     gojson.RawMessage(append([]byte(nil), b...)),
+		}, nil
 	}
 }
@@ -6,8 +6,8 @@ import (
 
 	gojson "encoding/json"
 
-	"github.com/magodo/pipeform/internal/terraform/views"
-	"github.com/magodo/pipeform/internal/terraform/views/json"
+	"github.com/magodo/pipeform/terraform/views"
+	"github.com/magodo/pipeform/terraform/views/json"
 	"github.com/stretchr/testify/require"
 	"github.com/zclconf/go-cty/cty"
 	ctyjson "github.com/zclconf/go-cty/cty/json"
@@ -51,6 +51,8 @@ var outputs = json.Outputs{
 	},
 }
 
+var testElapsed int64 = 1500
+
 func newBaseMsg(typ json.MessageType) views.BaseMsg {
 	return views.BaseMsg{
 		Level:     "info",
@@ -544,6 +546,90 @@ func TestUnmarshal(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "Test Abstract Message",
+			input: `
+{
+  "@level": "info",
+  "@message": "base message",
+  "@module": "terraform.ui",
+  "@timestamp": "2024-12-09T10:25:00Z",
+  "type": "test_abstract",
+  "test_abstract": {
+    "main.tftest.hcl": ["setup", "check"]
+  }
+}
+`,
+			msg: views.TestAbstractMsg{
+				BaseMsg: newBaseMsg(json.MessageTestAbstract),
+				TestAbstract: json.TestSuiteAbstract{
+					"main.tftest.hcl": {"setup", "check"},
+				},
+			},
+		},
+		{
+			name: "Test Run Message",
+			input: `
+{
+  "@level": "info",
+  "@message": "base message",
+  "@module": "terraform.ui",
+  "@timestamp": "2024-12-09T10:25:00Z",
+  "@testfile": "main.tftest.hcl",
+  "@testrun": "check",
+  "type": "test_run",
+  "test_run": {
+    "path": "main.tftest.hcl",
+	"run": "check",
+	"progress": "complete",
+	"elapsed": 1500,
+	"status": "pass"
+  }
+}
+`,
+			msg: views.TestRunMsg{
+				BaseMsg: newBaseMsg(json.MessageTestRun),
+				TestMeta: views.TestMeta{
+					File: "main.tftest.hcl",
+					Run:  "check",
+				},
+				TestRun: &json.TestRunStatus{
+					Path:     "main.tftest.hcl",
+					Run:      "check",
+					Progress: json.TestComplete,
+					Elapsed:  &testElapsed,
+					Status:   json.TestPass,
+				},
+			},
+		},
+		{
+			name: "Test Summary Message",
+			input: `
+{
+  "@level": "info",
+  "@message": "base message",
+  "@module": "terraform.ui",
+  "@timestamp": "2024-12-09T10:25:00Z",
+  "type": "test_summary",
+  "test_summary": {
+    "status": "fail",
+	"passed": 1,
+	"failed": 1,
+	"errored": 0,
+	"skipped": 2
+  }
+}
+`,
+			msg: views.TestSummaryMsg{
+				BaseMsg: newBaseMsg(json.MessageTestSummary),
+				TestSummary: &json.TestSuiteSummary{
+					Status:  json.TestFail,
+					Passed:  1,
+					Failed:  1,
+					Skipped: 2,
+				},
+			},
+		},
 	}
 
 	for _, tt := range cases {
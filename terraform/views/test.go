@@ -0,0 +1,117 @@
+package views
+
+import (
+	gojson "encoding/json"
+
+	"github.com/magodo/pipeform/terraform/views/json"
+)
+
+// This file define structures corresponding to the different logs defined in:
+// terraform/internal/command/views/test.go (TestJSON)
+
+// TestMeta is the metadata attached to the messages emitted during a test run.
+type TestMeta struct {
+	File string `json:"@testfile,omitempty"`
+	Run  string `json:"@testrun,omitempty"`
+}
+
+type TestAbstractMsg struct {
+	BaseMsg
+	TestAbstract json.TestSuiteAbstract `json:"test_abstract"`
+}
+
+func (m TestAbstractMsg) BaseMessage() BaseMsg {
+	return m.BaseMsg
+}
+
+type TestFileMsg struct {
+	BaseMsg
+	TestMeta
+	TestFile *json.TestFileStatus `json:"test_file"`
+}
+
+func (m TestFileMsg) BaseMessage() BaseMsg {
+	return m.BaseMsg
+}
+
+type TestRunMsg struct {
+	BaseMsg
+	TestMeta
+	TestRun *json.TestRunStatus `json:"test_run"`
+}
+
+func (m TestRunMsg) BaseMessage() BaseMsg {
+	return m.BaseMsg
+}
+
+// TestPlanMsg contains the plan of a run block, in the format of `terraform show -json`.
+type TestPlanMsg struct {
+	BaseMsg
+	TestMeta
+	TestPlan gojson.RawMessage `json:"test_plan"`
+}
+
+func (m TestPlanMsg) BaseMessage() BaseMsg {
+	return m.BaseMsg
+}
+
+// TestStateMsg contains the state of a run block, in the format of `terraform show -json`.
+type TestStateMsg struct {
+	BaseMsg
+	TestMeta
+	TestState gojson.RawMessage `json:"test_state"`
+}
+
+func (m TestStateMsg) BaseMessage() BaseMsg {
+	return m.BaseMsg
+}
+
+type TestSummaryMsg struct {
+	BaseMsg
+	TestSummary *json.TestSuiteSummary `json:"test_summary"`
+}
+
+func (m TestSummaryMsg) BaseMessage() BaseMsg {
+	return m.BaseMsg
+}
+
+type TestCleanupMsg struct {
+	BaseMsg
+	TestMeta
+	TestCleanup *json.TestFileCleanup `json:"test_cleanup"`
+}
+
+func (m TestCleanupMsg) BaseMessage() BaseMsg {
+	return m.BaseMsg
+}
+
+type TestInterruptMsg struct {
+	BaseMsg
+	TestInterrupt *json.TestFatalInterrupt `json:"test_interrupt"`
+}
+
+func (m TestInterruptMsg) BaseMessage() BaseMsg {
+	return m.BaseMsg
+}
+
+// TestStatusMsg is only emitted by newer versions of Terraform, whose payload is kept as is.
+type TestStatusMsg struct {
+	BaseMsg
+	TestMeta
+	TestStatus gojson.RawMessage `json:"test_status"`
+}
+
+func (m TestStatusMsg) BaseMessage() BaseMsg {
+	return m.BaseMsg
+}
+
+// TestRetryMsg is only emitted by newer versions of Terraform, whose payload is kept as is.
+type TestRetryMsg struct {
+	BaseMsg
+	TestMeta
+	TestRetry gojson.RawMessage `json:"test_retry"`
+}
+
+func (m TestRetryMsg) BaseMessage() BaseMsg {
+	return m.BaseMsg
+}
@@ -0,0 +1,60 @@
+package views
+
+import (
+	"strconv"
+	"strings"
+)
+
+// SupportedUIVersion is the version of the machine-readable UI protocol (i.e. VersionMsg.UI) that this package is built for.
+const SupportedUIVersion = "1.2"
+
+// IsUIVersionSupported tells whether the UI protocol version is not newer than the SupportedUIVersion.
+// A newer version is likely to carry message types or fields that are unknown to this package.
+// An empty or malformed version is regarded as supported.
+func IsUIVersionSupported(version string) bool {
+	return compareVersion(version, SupportedUIVersion) <= 0
+}
+
+// compareVersion compares the dot separated numeric versions, the missing components are regarded as 0.
+// It returns 0 if any of the versions is malformed.
+func compareVersion(a, b string) int {
+	as, ok := parseVersion(a)
+	if !ok {
+		return 0
+	}
+	bs, ok := parseVersion(b)
+	if !ok {
+		return 0
+	}
+	for i := 0; i < max(len(as), len(bs)); i++ {
+		var x, y int
+		if i < len(as) {
+			x = as[i]
+		}
+		if i < len(bs) {
+			y = bs[i]
+		}
+		if x != y {
+			if x < y {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+func parseVersion(v string) ([]int, bool) {
+	if v == "" {
+		return nil, false
+	}
+	var out []int
+	for _, seg := range strings.Split(v, ".") {
+		n, err := strconv.Atoi(seg)
+		if err != nil || n < 0 {
+			return nil, false
+		}
+		out = append(out, n)
+	}
+	return out, true
+}
@@ -0,0 +1,24 @@
+package views_test
+
+import (
+	"testing"
+
+	"github.com/magodo/pipeform/terraform/views"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIsUIVersionSupported(t *testing.T) {
+	cases := map[string]bool{
+		"":      true,
+		"0.1.0": true,
+		"1.0":   true,
+		"1.2":   true,
+		"1.2.0": true,
+		"1.3":   false,
+		"2.0":   false,
+		"x.y":   true,
+	}
+	for version, expect := range cases {
+		require.Equal(t, expect, views.IsUIVersionSupported(version), version)
+	}
+}
@@ -0,0 +1,37 @@
+// Package stream generates the machine readable UI streams of Terraform, e.g. for the benchmarks.
+package stream
+
+import "fmt"
+
+// Apply returns the messages of an apply that creates n resources, with up to parallelism operations in flight,
+// which outputs the count of the resources.
+// The timestamp of each message is left as the "%s" verb, to be filled in by the caller.
+func Apply(n, parallelism int) []string {
+	resource := func(i int) string {
+		return fmt.Sprintf(`{"addr":"null_resource.r[%[1]d]","module":"","resource":"null_resource.r[%[1]d]","implied_provider":"null","resource_type":"null_resource","resource_name":"r","resource_key":%[1]d}`, i)
+	}
+
+	msgs := []string{
+		`{"@level":"info","@message":"Terraform 1.10.3","@module":"terraform.ui","@timestamp":"%s","terraform":"1.10.3","type":"version","ui":"1.2"}`,
+	}
+	for i := 0; i < n; i++ {
+		msgs = append(msgs, fmt.Sprintf(`{"@level":"info","@message":"null_resource.r[%d]: Plan to create","@module":"terraform.ui","@timestamp":"%%s","change":{"resource":%s,"action":"create"},"type":"planned_change"}`, i, resource(i)))
+	}
+	msgs = append(msgs, fmt.Sprintf(`{"@level":"info","@message":"Plan: %[1]d to add, 0 to change, 0 to destroy.","@module":"terraform.ui","@timestamp":"%%s","changes":{"add":%[1]d,"change":0,"remove":0,"operation":"plan"},"type":"change_summary"}`, n))
+
+	complete := func(i int) {
+		msgs = append(msgs, fmt.Sprintf(`{"@level":"info","@message":"null_resource.r[%[1]d]: Creation complete after 0s [id=%[1]d]","@module":"terraform.ui","@timestamp":"%%s","hook":{"resource":%[2]s,"action":"create","id_key":"id","id_value":"%[1]d","elapsed_seconds":0},"type":"apply_complete"}`, i, resource(i)))
+	}
+	for i := 0; i < n; i++ {
+		msgs = append(msgs, fmt.Sprintf(`{"@level":"info","@message":"null_resource.r[%d]: Creating...","@module":"terraform.ui","@timestamp":"%%s","hook":{"resource":%s,"action":"create"},"type":"apply_start"}`, i, resource(i)))
+		if i >= parallelism {
+			complete(i - parallelism)
+		}
+	}
+	for i := max(n-parallelism, 0); i < n; i++ {
+		complete(i)
+	}
+	msgs = append(msgs, fmt.Sprintf(`{"@level":"info","@message":"Outputs: 1","@module":"terraform.ui","@timestamp":"%%s","outputs":{"count":{"sensitive":false,"type":"number","value":%d}},"type":"outputs"}`, n))
+	msgs = append(msgs, fmt.Sprintf(`{"@level":"info","@message":"Apply complete! Resources: %[1]d added, 0 changed, 0 destroyed.","@module":"terraform.ui","@timestamp":"%%s","changes":{"add":%[1]d,"change":0,"remove":0,"operation":"apply"},"type":"change_summary"}`, n))
+	return msgs
+}